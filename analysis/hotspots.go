@@ -0,0 +1,246 @@
+//
+//    Lollipops diagram generation framework for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package analysis
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Hotspot is a position or cluster of positions with more variants than
+// expected under a uniform background.
+type Hotspot struct {
+	// Type is "position" or "cluster".
+	Type  string
+	Start int
+	End   int
+	Count int
+	P     float64
+	Q     float64
+}
+
+// HotspotOptions configures FindHotspots.
+type HotspotOptions struct {
+	// MaxQ is the false discovery rate threshold for reporting hotspots.
+	MaxQ float64
+	// ClusterGap is the largest gap (in amino acids) between mutated
+	// positions in the same cluster.
+	ClusterGap int
+	// Permutations is the number of random permutations used for the
+	// cluster p-values.
+	Permutations int
+	// Seed makes the permutations reproducible.
+	Seed int64
+}
+
+// DefaultHotspotOptions are the options used by the command-line tool.
+var DefaultHotspotOptions = HotspotOptions{
+	MaxQ:         0.05,
+	ClusterGap:   5,
+	Permutations: 1000,
+	Seed:         1,
+}
+
+// FindHotspots tests each position of a protein of the given length for more
+// variants than expected if all variants were spread uniformly (one-sided
+// binomial test), and tests clusters of nearby mutated positions with a
+// permutation test of the maximal window count. P-values are adjusted with
+// the Benjamini-Hochberg procedure, and hotspots with q <= opts.MaxQ are
+// returned, positions first and then clusters, each ordered by start.
+func FindHotspots(variants []Variant, length int, opts HotspotOptions) []Hotspot {
+	counts, total := positionCounts(variants, length)
+	if total == 0 || length == 0 {
+		return nil
+	}
+
+	// per-position binomial tests, every position is a test (even if unmutated)
+	var positions []Hotspot
+	for pos := 1; pos <= length; pos++ {
+		if counts[pos] == 0 {
+			continue
+		}
+		positions = append(positions, Hotspot{
+			Type:  "position",
+			Start: pos,
+			End:   pos,
+			Count: counts[pos],
+			P:     binomialUpperTail(counts[pos], total, 1.0/float64(length)),
+		})
+	}
+	adjustBH(positions, length)
+
+	// clusters of mutated positions separated by at most ClusterGap
+	var clusters []Hotspot
+	for pos := 1; pos <= length; pos++ {
+		if counts[pos] == 0 {
+			continue
+		}
+		n := len(clusters)
+		if n > 0 && pos-clusters[n-1].End <= opts.ClusterGap {
+			clusters[n-1].End = pos
+			clusters[n-1].Count += counts[pos]
+			continue
+		}
+		clusters = append(clusters, Hotspot{Type: "cluster", Start: pos, End: pos, Count: counts[pos]})
+	}
+	// single-position clusters are already covered by the position tests
+	multi := clusters[:0]
+	for _, c := range clusters {
+		if c.End > c.Start {
+			multi = append(multi, c)
+		}
+	}
+	clusters = multi
+	permutationTest(clusters, total, length, opts)
+	adjustBH(clusters, len(clusters))
+
+	var res []Hotspot
+	for _, list := range [][]Hotspot{positions, clusters} {
+		for _, h := range list {
+			if h.Q <= opts.MaxQ {
+				res = append(res, h)
+			}
+		}
+	}
+	return res
+}
+
+// permutationTest sets the P value of each cluster to the fraction of random
+// uniform placements of total variants in which some window of the cluster's
+// width contains at least as many variants.
+func permutationTest(clusters []Hotspot, total, length int, opts HotspotOptions) {
+	if len(clusters) == 0 {
+		return
+	}
+	nperm := opts.Permutations
+	if nperm <= 0 {
+		nperm = 1000
+	}
+	rng := rand.New(rand.NewSource(opts.Seed))
+
+	exceed := make([]int, len(clusters))
+	counts := make([]int, length+1)
+	for i := 0; i < nperm; i++ {
+		for j := range counts {
+			counts[j] = 0
+		}
+		for j := 0; j < total; j++ {
+			counts[1+rng.Intn(length)]++
+		}
+		// the max window count only depends on width, so compute it once per width
+		maxByWidth := make(map[int]int)
+		for ci, c := range clusters {
+			width := c.End - c.Start + 1
+			mx, ok := maxByWidth[width]
+			if !ok {
+				mx = maxWindowCount(counts, width)
+				maxByWidth[width] = mx
+			}
+			if mx >= c.Count {
+				exceed[ci]++
+			}
+		}
+	}
+	for ci := range clusters {
+		clusters[ci].P = float64(1+exceed[ci]) / float64(1+nperm)
+	}
+}
+
+func maxWindowCount(counts []int, width int) int {
+	sum, mx := 0, 0
+	for i := 1; i < len(counts); i++ {
+		sum += counts[i]
+		if i > width {
+			sum -= counts[i-width]
+		}
+		if sum > mx {
+			mx = sum
+		}
+	}
+	return mx
+}
+
+// adjustBH sets the Q value of each hotspot using the Benjamini-Hochberg
+// procedure, where ntests is the total number of tests performed (which may
+// be larger than len(hs) if untested hypotheses have p=1).
+func adjustBH(hs []Hotspot, ntests int) {
+	order := make([]int, len(hs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(i, j int) bool { return hs[order[i]].P < hs[order[j]].P })
+	minQ := 1.0
+	for rank := len(order); rank >= 1; rank-- {
+		h := &hs[order[rank-1]]
+		q := h.P * float64(ntests) / float64(rank)
+		if q < minQ {
+			minQ = q
+		}
+		h.Q = minQ
+	}
+}
+
+// binomialUpperTail returns P(X >= k) for X ~ Binomial(n, p).
+func binomialUpperTail(k, n int, p float64) float64 {
+	if k <= 0 {
+		return 1
+	}
+	if k > n || p <= 0 {
+		return 0
+	}
+	if p >= 1 {
+		return 1
+	}
+	sum := 0.0
+	lp, lq := math.Log(p), math.Log1p(-p)
+	for i := k; i <= n; i++ {
+		term := logChoose(n, i) + float64(i)*lp + float64(n-i)*lq
+		sum += math.Exp(term)
+		if term < -50 && float64(i) > float64(n)*p {
+			// past the mode the terms only get smaller, so the rest are
+			// negligible (below it they may still be rising)
+			break
+		}
+	}
+	return math.Min(sum, 1)
+}
+
+func logChoose(n, k int) float64 {
+	a, _ := math.Lgamma(float64(n + 1))
+	b, _ := math.Lgamma(float64(k + 1))
+	c, _ := math.Lgamma(float64(n - k + 1))
+	return a - b - c
+}
+
+// WriteHotspotsTSV writes the hotspots as a tab-separated table with a header.
+func WriteHotspotsTSV(w io.Writer, hs []Hotspot) error {
+	_, err := fmt.Fprintln(w, "type\tstart\tend\tcount\tp_value\tq_value")
+	if err != nil {
+		return err
+	}
+	for _, h := range hs {
+		_, err = fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%.3g\t%.3g\n", h.Type, h.Start, h.End, h.Count, h.P, h.Q)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+//
+//    Lollipops diagram generation framework for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package analysis
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+// closeTo reports whether got is within a relative tolerance of want.
+func closeTo(got, want, tol float64) bool {
+	return math.Abs(got-want) <= tol*math.Max(math.Abs(want), 1e-300)
+}
+
+func TestBinomialUpperTail(t *testing.T) {
+	for _, c := range []struct {
+		k, n int
+		p    float64
+		want float64
+	}{
+		// exact values computed with rational arithmetic
+		{0, 10, 0.5, 1},
+		{5, 10, 0.5, 0.623046875},
+		{8, 10, 0.5, 0.0546875},
+		{11, 10, 0.5, 0},
+		{50, 100, 0.5, 0.5397946186935894},
+		{1, 100, 0.01, 0.6339676587267705},
+		{3, 100, 0.01, 0.07937320225218034},
+		{10, 100, 0.01, 7.631587532260619e-08},
+		{1, 1000, 1.0 / 393, 0.9217441802713752},
+		{2, 1000, 1.0 / 393, 0.7221119870861079},
+		{20, 1000, 1.0 / 393, 4.104890249846726e-12},
+		// k well below the mean, where the first terms are negligible
+		{1, 100000, 0.01, 1},
+		{950, 100000, 0.01, 0.9466733984769633},
+		{1050, 100000, 0.01, 0.058700915308083676},
+		// regions with no or all of the residues
+		{1, 10, 0, 0},
+		{10, 10, 1, 1},
+	} {
+		got := binomialUpperTail(c.k, c.n, c.p)
+		if !closeTo(got, c.want, 1e-6) {
+			t.Errorf("binomialUpperTail(%d, %d, %g) = %g, expected %g", c.k, c.n, c.p, got, c.want)
+		}
+	}
+}
+
+func TestAdjustBH(t *testing.T) {
+	ps := []float64{0.01, 0.04, 0.03, 0.005}
+	hs := make([]Hotspot, len(ps))
+	for i, p := range ps {
+		hs[i].P = p
+	}
+	// sorted p = 0.005 0.01 0.03 0.04 with 4 tests gives 0.02 0.02 0.04 0.04,
+	// and with 10 tests (6 untested) 0.05 0.05 0.1 0.1
+	for _, c := range []struct {
+		ntests int
+		want   []float64
+	}{
+		{4, []float64{0.02, 0.04, 0.04, 0.02}},
+		{10, []float64{0.05, 0.1, 0.1, 0.05}},
+	} {
+		adjustBH(hs, c.ntests)
+		for i, h := range hs {
+			if !closeTo(h.Q, c.want[i], 1e-12) {
+				t.Errorf("ntests=%d: q(%g) = %g, expected %g", c.ntests, h.P, h.Q, c.want[i])
+			}
+		}
+	}
+}
+
+// TestFindHotspotsUniform checks that no position is reported when every
+// position has the same, high count of variants, including one with far
+// fewer variants than expected.
+func TestFindHotspotsUniform(t *testing.T) {
+	var variants []Variant
+	for pos := 1; pos <= 200; pos++ {
+		count := 100
+		if pos == 50 {
+			count = 1
+		}
+		variants = append(variants, Variant{Label: "A" + strconv.Itoa(pos) + "V", Pos: pos, Count: count})
+	}
+	opts := DefaultHotspotOptions
+	opts.Permutations = 100
+	if hs := FindHotspots(variants, 200, opts); len(hs) != 0 {
+		t.Errorf("expected no hotspots, got %d starting with %+v", len(hs), hs[0])
+	}
+}
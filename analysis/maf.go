@@ -0,0 +1,326 @@
+//
+//    Lollipops diagram generation framework for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package analysis
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MAFOptions selects the mutations read by ReadMAF.
+type MAFOptions struct {
+	// Gene is the Hugo_Symbol of the mutations to read.
+	Gene string
+	// GroupBy optionally names a column of the MAF (e.g. a cohort column)
+	// whose values split the samples into groups. If the MAF has no such
+	// column, the groups are looked up in Clinical instead.
+	GroupBy string
+	// Clinical maps sample (or patient) IDs to their group, as read by
+	// ReadClinicalAttribute.
+	Clinical map[string]string
+}
+
+// MAFMutation is a protein change and the samples it was found in.
+type MAFMutation struct {
+	Label   string
+	Pos     int
+	Group   string
+	Samples int
+	// SampleIDs are the Tumor_Sample_Barcodes of the samples, in file order.
+	SampleIDs []string
+}
+
+// MAFResult summarizes the mutations read from a MAF.
+type MAFResult struct {
+	Mutations []MAFMutation
+	// Rows is the number of rows for the gene with a protein change.
+	Rows int
+	// Duplicates is the number of those rows that were dropped because the
+	// sample already had a mutation at the same position.
+	Duplicates int
+	// Samples is the number of distinct samples with a mutation in the gene.
+	Samples int
+	// GroupSamples is the number of samples in each group.
+	GroupSamples map[string]int
+}
+
+// mafChangeColumns are the columns used for protein changes, in order of
+// preference. HGVSp_Short is used by both cBioPortal and the GDC.
+var mafChangeColumns = []string{"HGVSp_Short", "Protein_Change", "Amino_Acid_Change"}
+
+// clinicalIDColumns are the columns used for sample or patient IDs in
+// cBioPortal and GDC clinical files, in order of preference.
+var clinicalIDColumns = []string{"SAMPLE_ID", "Tumor_Sample_Barcode", "PATIENT_ID",
+	"case_submitter_id", "submitter_id", "bcr_patient_barcode"}
+
+// ReadMAFFile is ReadMAF for a (optionally gzipped) file.
+func ReadMAFFile(filename string, opts MAFOptions) (*MAFResult, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(filename, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	res, err := ReadMAF(r, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	return res, nil
+}
+
+// ReadMAF reads the mutations in a gene from a Mutation Annotation Format
+// table, such as a cBioPortal data_mutations file or a GDC/TCGA MAF. Each
+// sample is counted once per position: further calls in the same sample at
+// a position already seen (e.g. from several callers or aliquots) are dropped.
+// Mutations are returned in position order, with the number of samples
+// having each change in each group.
+func ReadMAF(r io.Reader, opts MAFOptions) (*MAFResult, error) {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+
+	var header map[string]int
+	geneCol, sampleCol, changeCol, groupCol := -1, -1, -1, -1
+	type key struct {
+		label string
+		pos   int
+		group string
+	}
+	samples := make(map[key][]string)
+	seen := make(map[string]bool)
+	groups := make(map[string]string)
+	res := &MAFResult{GroupSamples: make(map[string]int)}
+
+	lineno := 0
+	for s.Scan() {
+		lineno++
+		line := strings.TrimRight(s.Text(), "\r")
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		p := strings.Split(line, "\t")
+		if header == nil {
+			header = make(map[string]int)
+			for i, name := range p {
+				header[strings.ToLower(strings.TrimSpace(name))] = i
+			}
+			geneCol = columnIndex(header, "Hugo_Symbol")
+			sampleCol = columnIndex(header, "Tumor_Sample_Barcode")
+			changeCol = columnIndex(header, mafChangeColumns...)
+			if geneCol == -1 || sampleCol == -1 || changeCol == -1 {
+				return nil, fmt.Errorf("expected Hugo_Symbol, Tumor_Sample_Barcode and %s columns",
+					strings.Join(mafChangeColumns, " or "))
+			}
+			if opts.GroupBy != "" {
+				groupCol = columnIndex(header, opts.GroupBy)
+				if groupCol == -1 && opts.Clinical == nil {
+					return nil, fmt.Errorf("no %s column, and no clinical attributes were given", opts.GroupBy)
+				}
+			}
+			continue
+		}
+		if geneCol >= len(p) || sampleCol >= len(p) || changeCol >= len(p) {
+			return nil, fmt.Errorf("line %d: expected %d columns", lineno, len(header))
+		}
+		if !strings.EqualFold(p[geneCol], opts.Gene) {
+			continue
+		}
+		label, pos := normalizeProteinChange(p[changeCol])
+		if label == "" {
+			// non-coding (e.g. intronic or UTR), splice site or unknown
+			continue
+		}
+		res.Rows++
+
+		sample := p[sampleCol]
+		if seen[sample+"\t"+strconv.Itoa(pos)] {
+			res.Duplicates++
+			continue
+		}
+		seen[sample+"\t"+strconv.Itoa(pos)] = true
+
+		group, ok := groups[sample]
+		if !ok {
+			if opts.GroupBy != "" {
+				group = "NA"
+				if groupCol != -1 && groupCol < len(p) && p[groupCol] != "" {
+					group = p[groupCol]
+				} else if g, ok := lookupClinical(opts.Clinical, sample); ok {
+					group = g
+				}
+			}
+			groups[sample] = group
+			res.Samples++
+			res.GroupSamples[group]++
+		}
+		k := key{label, pos, group}
+		samples[k] = append(samples[k], sample)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if header == nil {
+		return nil, fmt.Errorf("no header line")
+	}
+
+	for k, ids := range samples {
+		res.Mutations = append(res.Mutations, MAFMutation{Label: k.label, Pos: k.pos, Group: k.group,
+			Samples: len(ids), SampleIDs: ids})
+	}
+	sort.Slice(res.Mutations, func(i, j int) bool {
+		a, b := res.Mutations[i], res.Mutations[j]
+		if a.Pos != b.Pos {
+			return a.Pos < b.Pos
+		}
+		if a.Label != b.Label {
+			return a.Label < b.Label
+		}
+		return a.Group < b.Group
+	})
+	return res, nil
+}
+
+// proteinChangePattern matches a short HGVS protein change, e.g. R175H,
+// E298Kfs*47, K132_K133del or *394Qext*?.
+var proteinChangePattern = regexp.MustCompile(`^([A-Z*])([0-9]+)(?:_[A-Z*][0-9]+)?(.*)$`)
+
+// normalizeProteinChange converts a short HGVS protein change into the
+// lollipops change format, returning "" if it is not a protein change.
+// Stops are written as X, frameshifts without their new sequence and
+// synonymous changes with the residue repeated, so that p.R213* becomes
+// R213X, p.E298Kfs*47 becomes E298fs and p.R213= becomes R213R. Splice site
+// changes (e.g. p.X125_splice) and changes of unknown effect (p.M1?) are
+// not protein changes.
+func normalizeProteinChange(hgvs string) (string, int) {
+	hgvs = strings.TrimPrefix(strings.TrimSpace(hgvs), "p.")
+	hgvs = strings.Trim(hgvs, "()")
+	m := proteinChangePattern.FindStringSubmatch(hgvs)
+	if m == nil {
+		return "", 0
+	}
+	pos, err := strconv.Atoi(m[2])
+	if err != nil || pos < 1 {
+		return "", 0
+	}
+	ref, alt := m[1], strings.TrimPrefix(m[3], "_")
+	if alt == "splice" || alt == "?" {
+		return "", 0
+	}
+	if alt == "=" {
+		alt = ref
+	} else if strings.Contains(alt, "fs") {
+		alt = "fs"
+	} else if i := strings.Index(alt, "ext"); i != -1 {
+		alt = alt[:i+3]
+	}
+	label := strings.Replace(ref+m[2]+alt, "*", "X", -1)
+	return strings.TrimSuffix(label, "?"), pos
+}
+
+// columnIndex returns the index of the first of the named columns present
+// in header (with lower case keys), or -1 if there are none.
+func columnIndex(header map[string]int, names ...string) int {
+	for _, name := range names {
+		if i, ok := header[strings.ToLower(name)]; ok {
+			return i
+		}
+	}
+	return -1
+}
+
+// lookupClinical finds the group of a sample, matching either its ID or the
+// longest ID that is a prefix of it up to a '-', '_' or '.' (e.g. the TCGA
+// patient barcode TCGA-02-0001 of sample TCGA-02-0001-01C).
+func lookupClinical(clinical map[string]string, sample string) (string, bool) {
+	if g, ok := clinical[sample]; ok {
+		return g, true
+	}
+	best := ""
+	for id := range clinical {
+		if len(id) > len(best) && len(id) < len(sample) && strings.HasPrefix(sample, id) &&
+			strings.IndexByte("-_.", sample[len(id)]) != -1 {
+			best = id
+		}
+	}
+	if best == "" {
+		return "", false
+	}
+	return clinical[best], true
+}
+
+// ReadClinicalAttribute reads a cBioPortal clinical sample or patient file,
+// or a GDC clinical TSV, and returns the value of attribute for each sample
+// or patient ID. Missing values ("", "NA" or "'--") are omitted.
+func ReadClinicalAttribute(filename, attribute string) (map[string]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	res := make(map[string]string)
+	idCol, attrCol := -1, -1
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), "\r")
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		p := strings.Split(line, "\t")
+		if idCol == -1 {
+			header := make(map[string]int)
+			for i, name := range p {
+				header[strings.ToLower(strings.TrimSpace(name))] = i
+			}
+			idCol = columnIndex(header, clinicalIDColumns...)
+			attrCol = columnIndex(header, attribute)
+			if idCol == -1 {
+				return nil, fmt.Errorf("%s: expected a %s column", filename, strings.Join(clinicalIDColumns, " or "))
+			}
+			if attrCol == -1 {
+				return nil, fmt.Errorf("%s: no %s column", filename, attribute)
+			}
+			continue
+		}
+		if idCol >= len(p) || attrCol >= len(p) {
+			continue
+		}
+		v := strings.TrimSpace(p[attrCol])
+		if v == "" || v == "NA" || v == "'--" {
+			continue
+		}
+		res[p[idCol]] = v
+	}
+	return res, s.Err()
+}
@@ -0,0 +1,165 @@
+//
+//    Lollipops diagram generation framework for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package analysis
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeProteinChange(t *testing.T) {
+	for _, c := range []struct {
+		hgvs  string
+		label string
+		pos   int
+	}{
+		{"p.R175H", "R175H", 175},
+		{"p.(R175H)", "R175H", 175},
+		{"p.R213*", "R213X", 213},
+		{"p.E298Kfs*47", "E298fs", 298},
+		{"p.R213=", "R213R", 213},
+		{"p.K132_K133del", "K132del", 132},
+		{"p.*394Qext*?", "X394Qext", 394},
+		{"p.X125_splice", "", 0},
+		{"p.M1?", "", 0},
+		{"p.?", "", 0},
+		{"", "", 0},
+	} {
+		label, pos := normalizeProteinChange(c.hgvs)
+		if label != c.label || pos != c.pos {
+			t.Errorf("%q: got %q at %d, expected %q at %d", c.hgvs, label, pos, c.label, c.pos)
+		}
+	}
+}
+
+// testMAF has a duplicate call in S1, a synonymous change, a splice site
+// change and rows without a protein change or for another gene.
+const testMAF = "#version 2.4\n" +
+	"Hugo_Symbol\tTumor_Sample_Barcode\tHGVSp_Short\tCANCER_TYPE\n" +
+	"TP53\tS1\tp.R175H\tLUAD\n" +
+	"TP53\tS1\tp.R175H\tLUAD\n" +
+	"TP53\tS2\tp.R175H\tBRCA\n" +
+	"TP53\tS2\tp.R213=\tBRCA\n" +
+	"TP53\tS3\tp.X125_splice\tLUAD\n" +
+	"TP53\tS3\tp.R248Q\tLUAD\n" +
+	"TP53\tS4\t\tLUAD\n" +
+	"KRAS\tS5\tp.G12D\tLUAD\n"
+
+func TestReadMAF(t *testing.T) {
+	res, err := ReadMAF(strings.NewReader(testMAF), MAFOptions{Gene: "tp53", GroupBy: "CANCER_TYPE"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Rows != 5 || res.Duplicates != 1 || res.Samples != 3 {
+		t.Errorf("got %d rows, %d duplicates and %d samples, expected 5, 1 and 3", res.Rows, res.Duplicates, res.Samples)
+	}
+	if want := map[string]int{"LUAD": 2, "BRCA": 1}; !reflect.DeepEqual(res.GroupSamples, want) {
+		t.Errorf("got group samples %v, expected %v", res.GroupSamples, want)
+	}
+	want := []MAFMutation{
+		{Label: "R175H", Pos: 175, Group: "BRCA", Samples: 1, SampleIDs: []string{"S2"}},
+		{Label: "R175H", Pos: 175, Group: "LUAD", Samples: 1, SampleIDs: []string{"S1"}},
+		{Label: "R213R", Pos: 213, Group: "BRCA", Samples: 1, SampleIDs: []string{"S2"}},
+		{Label: "R248Q", Pos: 248, Group: "LUAD", Samples: 1, SampleIDs: []string{"S3"}},
+	}
+	if !reflect.DeepEqual(res.Mutations, want) {
+		t.Errorf("got mutations %+v, expected %+v", res.Mutations, want)
+	}
+
+	if _, err := ReadMAF(strings.NewReader("Hugo_Symbol\tHGVSp_Short\n"), MAFOptions{Gene: "TP53"}); err == nil {
+		t.Error("expected an error for a missing Tumor_Sample_Barcode column")
+	}
+	if _, err := ReadMAF(strings.NewReader(testMAF), MAFOptions{Gene: "TP53", GroupBy: "SUBTYPE"}); err == nil {
+		t.Error("expected an error for a missing group column without clinical attributes")
+	}
+}
+
+func TestReadClinicalAttribute(t *testing.T) {
+	dir := t.TempDir()
+	cbio := filepath.Join(dir, "data_clinical_sample.txt")
+	gdc := filepath.Join(dir, "clinical.tsv")
+	err := os.WriteFile(cbio, []byte("#Patient Identifier\tSample Identifier\tCancer Type\n"+
+		"#STRING\tSTRING\tSTRING\n"+
+		"PATIENT_ID\tSAMPLE_ID\tCANCER_TYPE\n"+
+		"P1\tS1\tLung Cancer\n"+
+		"P2\tS2\tNA\n"+
+		"P3\tS3\tBreast Cancer\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(gdc, []byte("case_id\tcase_submitter_id\tprimary_diagnosis\n"+
+		"a1\tTCGA-02-0001\tGlioblastoma\n"+
+		"a2\tTCGA-02-0003\t'--\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		filename, attribute string
+		want                map[string]string
+	}{
+		{cbio, "CANCER_TYPE", map[string]string{"S1": "Lung Cancer", "S3": "Breast Cancer"}},
+		{gdc, "primary_diagnosis", map[string]string{"TCGA-02-0001": "Glioblastoma"}},
+	} {
+		got, err := ReadClinicalAttribute(c.filename, c.attribute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %v, expected %v", filepath.Base(c.filename), got, c.want)
+		}
+	}
+	if _, err := ReadClinicalAttribute(cbio, "SUBTYPE"); err == nil {
+		t.Error("expected an error for a missing attribute column")
+	}
+}
+
+func TestLookupClinical(t *testing.T) {
+	clinical := map[string]string{"TCGA-02-0001": "GBM", "TCGA-02": "site", "S1": "LUAD"}
+	for _, c := range []struct {
+		sample, group string
+		ok            bool
+	}{
+		{"S1", "LUAD", true},
+		{"TCGA-02-0001-01C", "GBM", true},   // longest prefix
+		{"TCGA-02-00010-01C", "site", true}, // TCGA-02-0001 is not followed by a separator
+		{"S10", "", false},                  // S1 is not followed by a separator
+		{"OTHER-01", "", false},
+	} {
+		group, ok := lookupClinical(clinical, c.sample)
+		if group != c.group || ok != c.ok {
+			t.Errorf("%s: got %q %v, expected %q %v", c.sample, group, ok, c.group, c.ok)
+		}
+	}
+
+	// patient IDs from a clinical file group the samples of a MAF without the column
+	maf := "Hugo_Symbol\tTumor_Sample_Barcode\tHGVSp_Short\n" +
+		"TP53\tTCGA-02-0001-01C\tp.R175H\n" +
+		"TP53\tTCGA-99-0001-01A\tp.R175H\n"
+	res, err := ReadMAF(strings.NewReader(maf), MAFOptions{Gene: "TP53", GroupBy: "primary_diagnosis",
+		Clinical: map[string]string{"TCGA-02-0001": "Glioblastoma"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]int{"Glioblastoma": 1, "NA": 1}; !reflect.DeepEqual(res.GroupSamples, want) {
+		t.Errorf("got group samples %v, expected %v", res.GroupSamples, want)
+	}
+}
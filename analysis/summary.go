@@ -0,0 +1,155 @@
+//
+//    Lollipops diagram generation framework for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package analysis
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/joiningdata/lollipops/data"
+)
+
+// RegionSummary counts the variants falling within a protein region and
+// compares them to the count expected from the region's length.
+type RegionSummary struct {
+	// Type is "region", "motif" or "unannotated".
+	Type      string
+	Name      string
+	Accession string
+	Start     int
+	End       int
+	// Length is the number of amino acids in the region.
+	Length int
+
+	// Variants is the number of distinct variants and Samples the sum of
+	// their counts.
+	Variants int
+	Samples  int
+	// Expected is the number of samples expected if they were spread
+	// uniformly along the protein.
+	Expected float64
+	// Fold is Samples/Expected.
+	Fold float64
+	// P is the one-sided binomial test p-value for enrichment: the chance
+	// that at least Samples of all the samples fall in the region if each
+	// falls in it with probability Length/protein length.
+	P float64
+}
+
+// SummarizeRegions summarizes the variants inside each of the regions and
+// motifs of g, and within the sequence not covered by any of them.
+func SummarizeRegions(variants []Variant, g *data.GraphicResponse) []RegionSummary {
+	length64, _ := g.Length.Int64()
+	length := int(length64)
+	if length <= 0 {
+		return nil
+	}
+	counts, total := positionCounts(variants, length)
+	distinct := make([]int, length+1)
+	for _, v := range variants {
+		if v.Pos >= 1 && v.Pos <= length {
+			distinct[v.Pos]++
+		}
+	}
+
+	annotated := make([]bool, length+1)
+	var res []RegionSummary
+	summarize := func(typ string, r data.GraphicFeature) {
+		start, _ := r.Start.Int64()
+		end, _ := r.End.Int64()
+		rs := RegionSummary{
+			Type:      typ,
+			Name:      r.Text,
+			Accession: r.Metadata.Identifier,
+			Start:     int(start),
+			End:       int(end),
+		}
+		if rs.Name == "" {
+			rs.Name = r.Type
+		}
+		if rs.Start < 1 {
+			rs.Start = 1
+		}
+		if rs.End > length {
+			rs.End = length
+		}
+		for pos := rs.Start; pos <= rs.End; pos++ {
+			annotated[pos] = true
+			rs.Variants += distinct[pos]
+			rs.Samples += counts[pos]
+		}
+		rs.Length = rs.End - rs.Start + 1
+		if rs.Length < 0 {
+			rs.Length = 0
+		}
+		rs.enrichment(total, length)
+		res = append(res, rs)
+	}
+	for _, r := range g.Regions {
+		summarize("region", r)
+	}
+	for _, r := range g.Motifs {
+		if r.Type == "pfamb" {
+			continue
+		}
+		summarize("motif", r)
+	}
+
+	un := RegionSummary{Type: "unannotated", Name: "unannotated"}
+	for pos := 1; pos <= length; pos++ {
+		if annotated[pos] {
+			continue
+		}
+		un.Length++
+		un.Variants += distinct[pos]
+		un.Samples += counts[pos]
+	}
+	un.enrichment(total, length)
+	return append(res, un)
+}
+
+// enrichment fills in the expected count, fold enrichment and p-value given
+// the total number of samples along a protein of the given length.
+func (rs *RegionSummary) enrichment(total, length int) {
+	rs.Expected = float64(total) * float64(rs.Length) / float64(length)
+	if rs.Expected > 0 {
+		rs.Fold = float64(rs.Samples) / rs.Expected
+	}
+	rs.P = binomialUpperTail(rs.Samples, total, float64(rs.Length)/float64(length))
+}
+
+// WriteSummaryTSV writes the region summaries as a tab-separated table with
+// a header.
+func WriteSummaryTSV(w io.Writer, rows []RegionSummary) error {
+	_, err := fmt.Fprintln(w, "type\tname\taccession\tstart\tend\tlength\tvariants\tsamples\texpected\tfold_enrichment\tp_value")
+	if err != nil {
+		return err
+	}
+	for _, r := range rows {
+		start, end := fmt.Sprint(r.Start), fmt.Sprint(r.End)
+		if r.Type == "unannotated" {
+			start, end = "", ""
+		}
+		_, err = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%d\t%d\t%.2f\t%.2f\t%.3g\n", r.Type, r.Name, r.Accession,
+			start, end, r.Length, r.Variants, r.Samples, r.Expected, r.Fold, r.P)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+//
+//    Lollipops diagram generation framework for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package analysis
+
+import (
+	"testing"
+
+	"github.com/joiningdata/lollipops/data"
+)
+
+func TestSummarizeRegions(t *testing.T) {
+	g := &data.GraphicResponse{
+		Length: "100",
+		Regions: []data.GraphicFeature{
+			{Text: "Dom", Start: "1", End: "10", Metadata: data.GraphicMetadata{Identifier: "PF00001"}},
+		},
+	}
+	// 8 of 20 samples fall in the domain, which has 10% of the residues
+	variants := ParseVariants([]string{"R5C@6", "R5H@2", "G50D@10", "P90L@2"})
+	rows := SummarizeRegions(variants, g)
+	if len(rows) != 2 {
+		t.Fatalf("got %d rows, expected 2", len(rows))
+	}
+	for i, want := range []RegionSummary{
+		{Type: "region", Name: "Dom", Accession: "PF00001", Start: 1, End: 10, Length: 10,
+			Variants: 2, Samples: 8, Expected: 2, Fold: 4, P: 0.0004156350188454759},
+		{Type: "unannotated", Name: "unannotated", Length: 90,
+			Variants: 2, Samples: 12, Expected: 18, Fold: 12.0 / 18, P: 0.9999401414682596},
+	} {
+		got := rows[i]
+		if !closeTo(got.P, want.P, 1e-9) || !closeTo(got.Fold, want.Fold, 1e-12) {
+			t.Errorf("row %d: got p=%g fold=%g, expected p=%g fold=%g", i, got.P, got.Fold, want.P, want.Fold)
+		}
+		got.P, got.Fold = want.P, want.Fold
+		if got != want {
+			t.Errorf("row %d: got %+v, expected %+v", i, got, want)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+//
+//    Lollipops diagram generation framework for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package analysis provides statistics over the variants drawn in lollipop
+// diagrams, using the same amino acid coordinates as the diagrams.
+package analysis
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ChangePattern matches the <AMINO><CODON><AMINO> part of a protein change.
+var ChangePattern = regexp.MustCompile("(^|[A-Za-z]*)([0-9]+)([A-Za-z]*)")
+
+// Variant is a single protein change with the number of times it was seen.
+type Variant struct {
+	Label string
+	Pos   int
+	Count int
+}
+
+// ParseVariants parses protein changes in the <AMINO><CODON><AMINO><#COLOR><@COUNT>
+// format used for lollipops. Changes without a codon position are skipped.
+func ParseVariants(changelist []string) []Variant {
+	var res []Variant
+	for _, chg := range changelist {
+		if chg == "" {
+			continue
+		}
+		v := Variant{Count: 1}
+		if i := strings.Index(chg, "@"); i != -1 {
+			fmt.Sscanf(chg[i+1:], "%d", &v.Count)
+			chg = chg[:i]
+		}
+		if i := strings.Index(chg, "#"); i != -1 {
+			chg = chg[:i]
+		}
+		cpos := ChangePattern.FindStringSubmatch(chg)
+		if len(cpos) != 4 {
+			continue
+		}
+		fmt.Sscanf(cpos[2], "%d", &v.Pos)
+		v.Label = chg
+		res = append(res, v)
+	}
+	return res
+}
+
+// positionCounts sums the variant counts at each amino acid position 1..length.
+func positionCounts(variants []Variant, length int) ([]int, int) {
+	counts := make([]int, length+1)
+	total := 0
+	for _, v := range variants {
+		if v.Pos < 1 || v.Pos > length {
+			continue
+		}
+		counts[v.Pos] += v.Count
+		total += v.Count
+	}
+	return counts, total
+}
@@ -0,0 +1,251 @@
+//
+//    Lollipops command-line diagram generator for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/joiningdata/lollipops/data"
+	"github.com/joiningdata/lollipops/drawing"
+)
+
+// batchRow is a single diagram to draw in batch mode.
+type batchRow struct {
+	line         int
+	gene         string
+	accession    string
+	variants     []string
+	variantsFile string
+	output       string
+	// overrides are settings from columns named after drawing.Settings fields.
+	overrides map[string]interface{}
+
+	err error
+}
+
+// readManifest parses a tab-separated batch manifest. The first line is a
+// header naming the columns: gene, accession, variants (inline changes
+// separated by commas or spaces), variants_file (one change per line) and
+// output. Any other column names a drawing setting to override for that row.
+// A relative variants_file is read from the manifest's directory, and rows
+// without an output are written to GENE.svg (or ACCESSION.svg).
+func readManifest(filename string) ([]*batchRow, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var header []string
+	var rows []*batchRow
+	outputs := make(map[string]int)
+	s := bufio.NewScanner(f)
+	lineNum := 0
+	for s.Scan() {
+		lineNum++
+		line := strings.TrimRight(s.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		cols := strings.Split(line, "\t")
+		if header == nil {
+			for _, c := range cols {
+				header = append(header, strings.ToLower(strings.TrimSpace(c)))
+			}
+			continue
+		}
+
+		row := &batchRow{line: lineNum}
+		for i, val := range cols {
+			val = strings.TrimSpace(val)
+			if i >= len(header) {
+				return nil, fmt.Errorf("%s:%d: more columns than the header", filename, lineNum)
+			}
+			if val == "" {
+				continue
+			}
+			switch header[i] {
+			case "gene":
+				row.gene = val
+			case "accession":
+				row.accession = val
+			case "variants":
+				row.variants = strings.FieldsFunc(val, func(r rune) bool { return r == ',' || r == ' ' })
+			case "variants_file":
+				if !filepath.IsAbs(val) {
+					val = filepath.Join(filepath.Dir(filename), val)
+				}
+				row.variantsFile = val
+			case "output":
+				row.output = val
+			default:
+				if row.overrides == nil {
+					row.overrides = make(map[string]interface{})
+				}
+				// numbers and booleans are given as JSON, anything else is a string
+				var v interface{}
+				if json.Unmarshal([]byte(val), &v) != nil {
+					v = val
+				}
+				row.overrides[header[i]] = v
+			}
+		}
+		if row.gene == "" && row.accession == "" {
+			return nil, fmt.Errorf("%s:%d: one of gene or accession is required", filename, lineNum)
+		}
+		if row.output == "" {
+			name := row.gene
+			if name == "" {
+				name = row.accession
+			}
+			row.output = name + ".svg"
+		}
+		out := filepath.Clean(row.output)
+		if prev, ok := outputs[out]; ok {
+			return nil, fmt.Errorf("%s:%d: output %s is already written by line %d", filename, lineNum, row.output, prev)
+		}
+		outputs[out] = lineNum
+		rows = append(rows, row)
+	}
+	if err = s.Err(); err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// readVariantsFile reads one protein change per line, skipping blank lines
+// and lines starting with '#'.
+func readVariantsFile(filename string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var res []string
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		res = append(res, line)
+	}
+	return res, s.Err()
+}
+
+// runBatch draws every row of the manifest using a pool of workers, and
+// returns the number of rows that failed after reporting each row's result.
+func runBatch(filename string, workers, cacheSize int, domainsDatabase string, trackNames []string, extraTracks []data.GraphicTrack) int {
+	rows, err := readManifest(filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	// genes repeated across rows are only fetched once
+	data.SetCacheSize(cacheSize)
+
+	todo := make(chan *batchRow)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for row := range todo {
+				row.err = row.draw(domainsDatabase, trackNames, extraTracks)
+			}
+		}()
+	}
+	for _, row := range rows {
+		todo <- row
+	}
+	close(todo)
+	wg.Wait()
+
+	failed := 0
+	tw := tabwriter.NewWriter(os.Stderr, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "LINE\tGENE\tOUTPUT\tRESULT")
+	for _, row := range rows {
+		result := "ok"
+		if row.err != nil {
+			result = "FAILED: " + row.err.Error()
+			failed++
+		}
+		name := row.gene
+		if name == "" {
+			name = row.accession
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", row.line, name, row.output, result)
+	}
+	tw.Flush()
+	fmt.Fprintf(os.Stderr, "%d of %d diagrams drawn\n", len(rows)-failed, len(rows))
+	return failed
+}
+
+// draw fetches the data for a single row and writes its diagram.
+func (row *batchRow) draw(domainsDatabase string, trackNames []string, extraTracks []data.GraphicTrack) error {
+	s := drawing.DefaultSettings.Clone()
+	if row.overrides != nil {
+		if err := s.ApplyConfig(row.overrides); err != nil {
+			return err
+		}
+	}
+
+	variants := row.variants
+	if row.variantsFile != "" {
+		more, err := readVariantsFile(row.variantsFile)
+		if err != nil {
+			return err
+		}
+		variants = append(variants, more...)
+	}
+
+	acc := row.accession
+	if acc == "" {
+		var err error
+		if *queryDB == "GENENAME" {
+			acc, err = getProtID(row.gene)
+		} else {
+			acc, err = data.GetProtMapping(*queryDB, row.gene)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	d, err := data.GetGraphicData(context.Background(), acc, &data.FetchOptions{
+		Domains: domainsDatabase,
+		Tracks:  trackNames,
+		Entries: uniprotEntries,
+	})
+	if err != nil {
+		return err
+	}
+	d.Tracks = append(d.Tracks, extraTracks...)
+	return createOutput(row.output, s, d, variants)
+}
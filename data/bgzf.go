@@ -0,0 +1,124 @@
+//
+//    Lollipops diagram generation framework for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package data
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"sort"
+)
+
+// BGZF files (as written by bgzip) are gzip files made of independent blocks
+// of at most 64KiB, so that reading can start at any block. A position in
+// the file is given by a virtual offset: the compressed offset of the block
+// in the upper 48 bits, and the offset within the uncompressed block in the
+// lower 16 bits.
+
+var errNotBGZF = errors.New("not a BGZF file")
+
+// bgzfBlockSize returns the compressed size of the BGZF block starting with
+// the gzip header in head.
+func bgzfBlockSize(head []byte) (int, bool) {
+	if len(head) < 12 || head[0] != 0x1f || head[1] != 0x8b || head[3]&4 == 0 {
+		return 0, false
+	}
+	xlen := int(head[10]) | int(head[11])<<8
+	if len(head) < 12+xlen {
+		return 0, false
+	}
+	extra := head[12 : 12+xlen]
+	for len(extra) >= 4 {
+		slen := int(extra[2]) | int(extra[3])<<8
+		if len(extra) < 4+slen {
+			break
+		}
+		if extra[0] == 'B' && extra[1] == 'C' && slen == 2 {
+			return (int(extra[4]) | int(extra[5])<<8) + 1, true
+		}
+		extra = extra[4+slen:]
+	}
+	return 0, false
+}
+
+// bgzfReader decompresses a BGZF file one block at a time, recording where
+// each block starts so that uncompressed offsets can be converted into
+// virtual offsets.
+type bgzfReader struct {
+	r       io.Reader
+	coffset int64
+	uoffset int64
+	// blocks are the compressed and uncompressed offsets of each block.
+	blocks [][2]int64
+	buf    []byte
+}
+
+func (b *bgzfReader) Read(p []byte) (int, error) {
+	for len(b.buf) == 0 {
+		if err := b.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, b.buf)
+	b.buf = b.buf[n:]
+	return n, nil
+}
+
+// next reads and decompresses the next block.
+func (b *bgzfReader) next() error {
+	head := make([]byte, 12, 18)
+	if _, err := io.ReadFull(b.r, head); err != nil {
+		return err
+	}
+	xlen := int(head[10]) | int(head[11])<<8
+	head = append(head, make([]byte, xlen)...)
+	if _, err := io.ReadFull(b.r, head[12:]); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	size, ok := bgzfBlockSize(head)
+	if !ok || size < len(head) {
+		return errNotBGZF
+	}
+	block := append(head, make([]byte, size-len(head))...)
+	if _, err := io.ReadFull(b.r, block[len(head):]); err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(block))
+	if err != nil {
+		return err
+	}
+	b.buf, err = io.ReadAll(zr)
+	if err != nil {
+		return err
+	}
+	b.blocks = append(b.blocks, [2]int64{b.coffset, b.uoffset})
+	b.coffset += int64(size)
+	b.uoffset += int64(len(b.buf))
+	return nil
+}
+
+// virtualOffset converts an offset in the uncompressed data read so far
+// into a virtual offset.
+func (b *bgzfReader) virtualOffset(uoffset int64) int64 {
+	i := sort.Search(len(b.blocks), func(i int) bool { return b.blocks[i][1] > uoffset }) - 1
+	if i < 0 {
+		return 0
+	}
+	return b.blocks[i][0]<<16 | (uoffset - b.blocks[i][1])
+}
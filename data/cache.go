@@ -0,0 +1,121 @@
+//
+//    Lollipops diagram generation framework for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package data
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// responseCache keeps the bodies of successful GET responses in memory so
+// that repeated lookups (e.g. by a long-running server) only hit the remote
+// APIs once. It is disabled until SetCacheSize is called.
+type responseCache struct {
+	mu      sync.Mutex
+	max     int
+	entries map[string]cachedResponse
+	order   []string // oldest first
+
+	hits, misses int64
+}
+
+type cachedResponse struct {
+	status     string
+	statusCode int
+	header     http.Header
+	body       []byte
+}
+
+var cache = &responseCache{}
+
+// SetCacheSize enables caching of up to n remote API responses, shared by
+// all of the fetch functions in this package. A size of 0 disables the cache.
+func SetCacheSize(n int) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.max = n
+	cache.entries = make(map[string]cachedResponse)
+	cache.order = nil
+}
+
+// CacheStats returns the number of cache hits and misses so far.
+func CacheStats() (hits, misses int64) {
+	return atomic.LoadInt64(&cache.hits), atomic.LoadInt64(&cache.misses)
+}
+
+// get returns a copy of the response cached for key, if any.
+func (c *responseCache) get(key string) (*http.Response, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.max <= 0 {
+		return nil, false
+	}
+	cr, ok := c.entries[key]
+	if !ok {
+		atomic.AddInt64(&c.misses, 1)
+		return nil, false
+	}
+	atomic.AddInt64(&c.hits, 1)
+	return &http.Response{
+		Status:     cr.status,
+		StatusCode: cr.statusCode,
+		Header:     cr.header.Clone(),
+		Body:       io.NopCloser(bytes.NewReader(cr.body)),
+	}, true
+}
+
+// put reads and caches resp if it was successful, and returns a response
+// that can be read in its place.
+func (c *responseCache) put(key string, resp *http.Response) (*http.Response, error) {
+	c.mu.Lock()
+	enabled := c.max > 0
+	c.mu.Unlock()
+	if !enabled || (resp.StatusCode != 200 && resp.StatusCode != 204) {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.max <= 0 {
+		return resp, nil
+	}
+	if _, ok := c.entries[key]; !ok {
+		c.order = append(c.order, key)
+	}
+	c.entries[key] = cachedResponse{
+		status:     resp.Status,
+		statusCode: resp.StatusCode,
+		header:     resp.Header.Clone(),
+		body:       body,
+	}
+	for len(c.order) > c.max {
+		delete(c.entries, c.order[0])
+		c.order = c.order[1:]
+	}
+	return resp, nil
+}
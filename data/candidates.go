@@ -0,0 +1,152 @@
+//
+//    Lollipops diagram generation framework for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package data
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// How a candidate's gene names match the searched symbol, best first.
+const (
+	MatchPrimary = iota
+	MatchSynonym
+	MatchOther
+)
+
+// ProtCandidate is a UniProt entry found when searching for a gene symbol.
+type ProtCandidate struct {
+	Accession string
+	GeneName  string
+	Synonyms  []string
+	Length    int
+	Reviewed  bool
+	// Match is MatchPrimary if the symbol is the primary gene name,
+	// MatchSynonym if it is one of the synonyms, and MatchOther otherwise.
+	Match int
+}
+
+// Better reports whether c is ranked strictly before o. Entries that match
+// the symbol by gene name are ranked first, reviewed (Swiss-Prot) entries
+// before unreviewed ones, and then primary gene name matches before synonyms.
+// So a reviewed entry listing the symbol as a synonym is preferred over an
+// unreviewed fragment using it as its primary name.
+func (c ProtCandidate) Better(o ProtCandidate) bool {
+	if (c.Match == MatchOther) != (o.Match == MatchOther) {
+		return o.Match == MatchOther
+	}
+	if c.Reviewed != o.Reviewed {
+		return c.Reviewed
+	}
+	return c.Match < o.Match
+}
+
+// GetProtCandidates is GetProtCandidatesContext using context.Background().
+func GetProtCandidates(symbol string) ([]ProtCandidate, error) {
+	return GetProtCandidatesContext(context.Background(), symbol)
+}
+
+// GetProtCandidatesContext searches for human UniProt entries with the gene
+// symbol as a primary gene name or synonym, and returns them best first
+// (see ProtCandidate.Better). Entries that are ranked equally keep the
+// order returned by UniProt.
+func GetProtCandidatesContext(ctx context.Context, symbol string) ([]ProtCandidate, error) {
+	apiURL := fmt.Sprintf(UniProtCandidatesURL, url.QueryEscape(symbol))
+	resp, err := httpGet(ctx, apiURL)
+	if err != nil {
+		return nil, connectError("Uniprot", err)
+	}
+	defer resp.Body.Close()
+	respBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	respBytes = uniprotDecompress(respBytes)
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("uniprot error: %s", resp.Status)
+	}
+	return parseProtCandidates(string(respBytes), symbol), nil
+}
+
+// parseProtCandidates parses and ranks the TSV search results (with columns
+// accession, reviewed, gene_primary, gene_synonym and length).
+func parseProtCandidates(tsv, symbol string) []ProtCandidate {
+	var res []ProtCandidate
+	for i, line := range strings.Split(tsv, "\n") {
+		if i == 0 { // skip header
+			continue
+		}
+		p := strings.Split(strings.TrimRight(line, "\r"), "\t")
+		if len(p) < 5 || p[0] == "" {
+			continue
+		}
+		c := ProtCandidate{
+			Accession: p[0],
+			Reviewed:  p[1] == "reviewed",
+			GeneName:  p[2],
+			Synonyms:  strings.Fields(strings.Replace(p[3], ";", " ", -1)),
+		}
+		c.Length, _ = strconv.Atoi(p[4])
+		c.setMatch(symbol)
+		res = append(res, c)
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Better(res[j])
+	})
+	return res
+}
+
+// setMatch sets c.Match to how the gene names of c match symbol.
+func (c *ProtCandidate) setMatch(symbol string) {
+	c.Match = MatchOther
+	// entries for several genes list them separated by "; "
+	for _, g := range strings.Split(c.GeneName, ";") {
+		if strings.EqualFold(strings.TrimSpace(g), symbol) {
+			c.Match = MatchPrimary
+			return
+		}
+	}
+	for _, g := range c.Synonyms {
+		if strings.EqualFold(g, symbol) {
+			c.Match = MatchSynonym
+		}
+	}
+}
+
+// WriteProtCandidates writes a numbered table of the candidates (starting
+// from 1, as used by -pick).
+func WriteProtCandidates(w io.Writer, cands []ProtCandidate) error {
+	matches := []string{MatchPrimary: "gene name", MatchSynonym: "synonym", MatchOther: "other"}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "#\tACCESSION\tGENE\tMATCH\tREVIEWED\tLENGTH\tSYNONYMS")
+	for i, c := range cands {
+		reviewed := "no"
+		if c.Reviewed {
+			reviewed = "yes"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%d\t%s\n", i+1, c.Accession, c.GeneName, matches[c.Match],
+			reviewed, c.Length, strings.Join(c.Synonyms, " "))
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,73 @@
+//
+//    Lollipops diagram generation framework for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package data
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"strings"
+)
+
+// DomainPalette is the default set of #RRGGBB colors assigned to domains.
+var DomainPalette = []string{
+	"#2DCF00", "#FF5353", "#5B5BFF", "#EBD61D", "#BA21E0", "#FF9C42", "#FF7DFF",
+	"#B9264F", "#BABA21", "#C48484", "#1F88A7", "#CAFEB8", "#4A9586", "#CEB86C",
+}
+
+// DomainColor deterministically picks a color from palette for the domain
+// accession, so that the same domain is colored identically in every diagram
+// regardless of which other domains are present. Different domains can hash
+// to the same color; use a color map (see LoadColorMap) to tell them apart.
+func DomainColor(accession string, palette []string) string {
+	if len(palette) == 0 {
+		return ""
+	}
+	h := fnv.New32a()
+	h.Write([]byte(accession))
+	return palette[h.Sum32()%uint32(len(palette))]
+}
+
+// LoadColorMap reads a whitespace-separated file of domain accession (or name)
+// and #RRGGBB color pairs, one per line. Blank lines and lines starting with
+// '#' are ignored.
+func LoadColorMap(filename string) (map[string]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	colors := make(map[string]string)
+	s := bufio.NewScanner(f)
+	lineno := 0
+	for s.Scan() {
+		lineno++
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 || !strings.HasPrefix(fields[1], "#") {
+			return nil, fmt.Errorf("%s:%d: expected 'ACCESSION #RRGGBB'", filename, lineno)
+		}
+		colors[fields[0]] = fields[1]
+	}
+	return colors, s.Err()
+}
@@ -18,7 +18,11 @@
 package data
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
 	"os"
 	"strings"
 )
@@ -47,6 +51,22 @@ type GraphicFeature struct {
 type GraphicMetadata struct {
 	Description string `json:"description"`
 	Identifier  string `json:"identifier"`
+
+	// The remaining fields describe the protein as a whole, and are only
+	// set in GraphicResponse.Metadata.
+
+	Accession       string `json:"accession,omitempty"`
+	GeneName        string `json:"gene_name,omitempty"`
+	ProteinName     string `json:"protein_name,omitempty"`
+	Organism        string `json:"organism,omitempty"`
+	EntryVersion    int    `json:"entry_version,omitempty"`
+	SequenceVersion int    `json:"sequence_version,omitempty"`
+}
+
+// GraphicTrack is a named row of features drawn below the backbone.
+type GraphicTrack struct {
+	Name     string           `json:"name"`
+	Features []GraphicFeature `json:"features"`
 }
 
 type GraphicResponse struct {
@@ -54,6 +74,7 @@ type GraphicResponse struct {
 	Metadata GraphicMetadata  `json:"metadata"`
 	Motifs   []GraphicFeature `json:"motifs"`
 	Regions  []GraphicFeature `json:"regions"`
+	Tracks   []GraphicTrack   `json:"tracks,omitempty"`
 }
 
 type InterProMetaData struct {
@@ -99,11 +120,87 @@ type InterProFeature struct {
 }
 
 type UniProtSequence struct {
-	Length int `json:"length"`
+	Value  string `json:"value"`
+	Length int    `json:"length"`
+}
+
+type UniProtPosition struct {
+	Value    int    `json:"value"`
+	Modifier string `json:"modifier"`
+}
+
+type UniProtLocation struct {
+	Start UniProtPosition `json:"start"`
+	End   UniProtPosition `json:"end"`
+}
+
+type UniProtFeature struct {
+	Type        string          `json:"type"`
+	Description string          `json:"description"`
+	Location    UniProtLocation `json:"location"`
+}
+
+type UniProtValue struct {
+	Value string `json:"value"`
+}
+
+type UniProtName struct {
+	FullName UniProtValue `json:"fullName"`
+}
+
+type UniProtProteinDescription struct {
+	RecommendedName UniProtName   `json:"recommendedName"`
+	SubmissionNames []UniProtName `json:"submissionNames"`
+}
+
+type UniProtGene struct {
+	GeneName UniProtValue   `json:"geneName"`
+	Synonyms []UniProtValue `json:"synonyms"`
+}
+
+type UniProtOrganism struct {
+	ScientificName string `json:"scientificName"`
+	CommonName     string `json:"commonName"`
+	TaxonID        int    `json:"taxonId"`
+}
+
+type UniProtEntryAudit struct {
+	EntryVersion    int `json:"entryVersion"`
+	SequenceVersion int `json:"sequenceVersion"`
 }
 
 type UniProtResponse struct {
-	Sequence UniProtSequence `json:"sequence"`
+	PrimaryAccession    string                    `json:"primaryAccession"`
+	SecondaryAccessions []string                  `json:"secondaryAccessions"`
+	UniProtKBID         string                    `json:"uniProtkbId"`
+	EntryType           string                    `json:"entryType"`
+	ProteinDescription  UniProtProteinDescription `json:"proteinDescription"`
+	Genes               []UniProtGene             `json:"genes"`
+	Organism            UniProtOrganism           `json:"organism"`
+	EntryAudit          UniProtEntryAudit         `json:"entryAudit"`
+	Sequence            UniProtSequence           `json:"sequence"`
+	Features            []UniProtFeature          `json:"features"`
+}
+
+// Metadata returns the accession, names, organism and versions of the entry.
+func (u *UniProtResponse) Metadata() GraphicMetadata {
+	m := GraphicMetadata{
+		Accession:       u.PrimaryAccession,
+		Identifier:      u.PrimaryAccession,
+		ProteinName:     u.ProteinDescription.RecommendedName.FullName.Value,
+		Organism:        u.Organism.ScientificName,
+		EntryVersion:    u.EntryAudit.EntryVersion,
+		SequenceVersion: u.EntryAudit.SequenceVersion,
+	}
+	if m.ProteinName == "" && len(u.ProteinDescription.SubmissionNames) > 0 {
+		// unreviewed entries only have submitted names
+		m.ProteinName = u.ProteinDescription.SubmissionNames[0].FullName.Value
+	}
+	m.Description = m.ProteinName
+	if len(u.Genes) > 0 {
+		m.GeneName = u.Genes[0].GeneName.Value
+	}
+	return m
 }
 
 func GetLocalGraphicData(filename string) (*GraphicResponse, error) {
@@ -128,3 +225,16 @@ func GetLocalGraphicData(filename string) (*GraphicResponse, error) {
 	}
 	return pf, err
 }
+
+// connectError replaces a network timeout with a more helpful error message
+// naming the remote service, and returns other errors (including context
+// cancellation) unchanged.
+func connectError(service string, err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	if err, ok := err.(net.Error); ok && err.Timeout() {
+		return fmt.Errorf("unable to connect to %s, check your internet connection or try again later (%s)", service, err)
+	}
+	return err
+}
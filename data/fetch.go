@@ -0,0 +1,122 @@
+//
+//    Lollipops diagram generation framework for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package data
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// FetchOptions selects the data fetched by GetGraphicData.
+type FetchOptions struct {
+	// Domains is the source of protein domains, "pfam" (default), "interpro",
+	// or "uniprot" to use the features of the UniProt entry instead of InterPro.
+	Domains string
+	// Tracks are the names of UniProt feature tracks to include (see UniProtTracks).
+	Tracks []string
+	// Entries, if set, is read for the UniProt entry instead of rest.uniprot.org.
+	Entries *UniProtFile
+}
+
+// GetGraphicData fetches the length, domains, motifs and feature tracks for
+// the UniProt accession concurrently, so that the total latency is that of
+// the slowest request. If any request fails or ctx is cancelled, the other
+// requests are cancelled and the first error is returned.
+func GetGraphicData(ctx context.Context, accession string, opts *FetchOptions) (*GraphicResponse, error) {
+	if opts == nil {
+		opts = &FetchOptions{}
+	}
+	database := opts.Domains
+	if database == "" {
+		database = "pfam"
+	}
+	// stop the remaining requests as soon as one fails
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		entry   *UniProtResponse
+		regions []GraphicFeature
+		motifs  []GraphicFeature
+	)
+	fetches := []func() error{
+		func() (err error) {
+			if opts.Entries != nil {
+				entry, err = opts.Entries.Entry(accession)
+			} else {
+				entry, err = GetUniProtEntryContext(ctx, accession)
+			}
+			return err
+		},
+	}
+	if database != "uniprot" {
+		fetches = append(fetches,
+			func() (err error) {
+				regions, err = GetProteinMatchesContext(ctx, database, accession)
+				return err
+			},
+			func() (err error) {
+				motifs, err = GetSequenceFeaturesContext(ctx, accession)
+				return err
+			},
+		)
+	}
+
+	errs := make(chan error, len(fetches))
+	wg := &sync.WaitGroup{}
+	for _, fetch := range fetches {
+		wg.Add(1)
+		go func(fetch func() error) {
+			defer wg.Done()
+			errs <- fetch()
+		}(fetch)
+	}
+	for range fetches {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case err := <-errs:
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	// every fetch has reported, so the results are safe to read
+	wg.Wait()
+	if database == "uniprot" {
+		regions = entry.Domains()
+		motifs = entry.Motifs()
+	}
+
+	g := &GraphicResponse{
+		Length:   json.Number(fmt.Sprint(entry.Sequence.Length)),
+		Metadata: entry.Metadata(),
+		Regions:  regions,
+		Motifs:   motifs,
+	}
+	if len(opts.Tracks) > 0 {
+		tracks, err := entry.Tracks(opts.Tracks)
+		if err != nil {
+			return nil, err
+		}
+		g.Tracks = tracks
+	}
+	return g, nil
+}
@@ -4,27 +4,49 @@
 package data
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
 )
 
-func httpGet(url string) (*http.Response, error) {
-	return http.Get(url)
+func httpGet(ctx context.Context, url string) (*http.Response, error) {
+	if resp, ok := cache.get(url); ok {
+		return resp, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	return cache.put(url, resp)
 }
 
-func httpGetInsecure(url string) (*http.Response, error) {
+func httpGetInsecure(ctx context.Context, url string) (*http.Response, error) {
 	tr := &http.Transport{
 		TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
 	}
 	client := &http.Client{Transport: tr}
 	fmt.Fprintln(os.Stderr, "WARNING: making insecure request to ", url)
 	fmt.Fprintln(os.Stderr, "         eventually this will no longer work correctly!")
-	return client.Get(url)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
 }
 
-func httpPostForm(url string, vals url.Values) (*http.Response, error) {
-	return http.PostForm(url, vals)
+func httpPostForm(ctx context.Context, url string, vals url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader(vals.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return http.DefaultClient.Do(req)
 }
@@ -4,6 +4,7 @@
 package data
 
 import (
+	"context"
 	"io/ioutil"
 	"net/http"
 	"net/url"
@@ -11,29 +12,32 @@ import (
 )
 
 // implements http.Get but makes wasm's fetch work with CORS
-func httpGet(url string) (*http.Response, error) {
-	req, err := http.NewRequest("GET", url, nil)
+func httpGet(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Add("js.fetch:mode", "cors")
 
 	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
 	bb, err := ioutil.ReadAll(resp.Body)
 	resp.Body.Close()
 	resp.Body = ioutil.NopCloser(strings.NewReader(string(bb)))
 	return resp, err
 }
 
-func httpGetInsecure(url string) (*http.Response, error) {
+func httpGetInsecure(ctx context.Context, url string) (*http.Response, error) {
 	// I am not willing to test if this can be configured in WASM.
-	return httpGet(url)
+	return httpGet(ctx, url)
 }
 
 // implements http.PostForm but makes wasm's fetch work with CORS
-func httpPostForm(wurl string, vals url.Values) (*http.Response, error) {
+func httpPostForm(ctx context.Context, wurl string, vals url.Values) (*http.Response, error) {
 	body := strings.NewReader(vals.Encode())
-	req, err := http.NewRequest("POST", wurl, body)
+	req, err := http.NewRequestWithContext(ctx, "POST", wurl, body)
 	if err != nil {
 		return nil, err
 	}
@@ -41,6 +45,9 @@ func httpPostForm(wurl string, vals url.Values) (*http.Response, error) {
 	req.Header.Add("js.fetch:mode", "cors")
 
 	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
 	bb, err := ioutil.ReadAll(resp.Body)
 	resp.Body.Close()
 	resp.Body = ioutil.NopCloser(strings.NewReader(string(bb)))
@@ -18,11 +18,10 @@
 package data
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"net"
-	"os"
 	"sort"
 )
 
@@ -30,7 +29,14 @@ const InterProURL = "https://www.ebi.ac.uk/interpro/api/entry/%s/protein/uniprot
 const InterProLink = "https://www.ebi.ac.uk/interpro/entry/%s/%s"
 const SequenceFeaturesURL = "https://www.ebi.ac.uk/interpro/api/protein/UniProt/%s/?extra_features=true"
 
+// GetProteinMatches is GetProteinMatchesContext using context.Background().
 func GetProteinMatches(database string, accession string) ([]GraphicFeature, error) {
+	return GetProteinMatchesContext(context.Background(), database, accession)
+}
+
+// GetProteinMatchesContext returns the domains of the UniProt accession from
+// database, "pfam" or "interpro".
+func GetProteinMatchesContext(ctx context.Context, database string, accession string) ([]GraphicFeature, error) {
 	var sourceDatabase string
 	filterDomains := false
 	if database == "interpro" {
@@ -40,13 +46,9 @@ func GetProteinMatches(database string, accession string) ([]GraphicFeature, err
 		sourceDatabase = "pfam"
 	}
 	queryURL := fmt.Sprintf(InterProURL, sourceDatabase, accession)
-	resp, err := httpGet(queryURL)
+	resp, err := httpGet(ctx, queryURL)
 	if err != nil {
-		if err, ok := err.(net.Error); ok && err.Timeout() {
-			fmt.Fprintf(os.Stderr, "Unable to connect to InterPro. Check your internet connection or try again later.")
-			os.Exit(1)
-		}
-		return nil, err
+		return nil, connectError("InterPro", err)
 	}
 	respBytes, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
@@ -102,27 +104,25 @@ func GetProteinMatches(database string, accession string) ([]GraphicFeature, err
 		return end1 < end2
 	})
 
-	hexColors := [14]string{
-		"#2DCF00", "#FF5353", "#5B5BFF", "#EBD61D", "#BA21E0", "#FF9C42", "#FF7DFF",
-		"#B9264F", "#BABA21", "#C48484", "#1F88A7", "#CAFEB8", "#4A9586", "#CEB86C",
-	}
-
 	for i := 0; i < len(gs); i++ {
-		gs[i].Color = hexColors[i%len(hexColors)]
+		gs[i].Color = DomainColor(gs[i].Metadata.Identifier, DomainPalette)
 	}
 
 	return gs, nil
 }
 
+// GetSequenceFeatures is GetSequenceFeaturesContext using context.Background().
 func GetSequenceFeatures(accession string) ([]GraphicFeature, error) {
+	return GetSequenceFeaturesContext(context.Background(), accession)
+}
+
+// GetSequenceFeaturesContext returns the motifs (disordered regions,
+// transmembrane, etc) of the UniProt accession from InterPro.
+func GetSequenceFeaturesContext(ctx context.Context, accession string) ([]GraphicFeature, error) {
 	queryURL := fmt.Sprintf(SequenceFeaturesURL, accession)
-	resp, err := httpGet(queryURL)
+	resp, err := httpGet(ctx, queryURL)
 	if err != nil {
-		if err, ok := err.(net.Error); ok && err.Timeout() {
-			fmt.Fprintf(os.Stderr, "Unable to connect to InterPro. Check your internet connection or try again later.")
-			os.Exit(1)
-		}
-		return nil, err
+		return nil, connectError("InterPro", err)
 	}
 	respBytes, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
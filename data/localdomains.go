@@ -0,0 +1,519 @@
+//
+//    Lollipops diagram generation framework for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package data
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LocalDomainOptions selects the hits used by GetLocalDomains.
+type LocalDomainOptions struct {
+	// Protein is the sequence ID to use hits for. If the file describes only
+	// one protein, its hits are used even if the ID does not match.
+	Protein string
+	// Domains is "pfam" (default) to use only Pfam hits from InterProScan, or
+	// "interpro" to also use CDD, NCBIfam, PROSITE profile and SMART hits.
+	// All hits in hmmscan output are used.
+	Domains string
+	// MaxEValue drops hits with a larger E-value. Zero keeps every hit.
+	MaxEValue float64
+	// KeepOverlaps keeps overlapping hits, instead of only the hit with the
+	// best E-value.
+	KeepOverlaps bool
+}
+
+// interProScanAnalyses are the InterProScan member databases used for
+// domains, mapped to their InterPro website name and whether their score is
+// an E-value.
+var interProScanAnalyses = map[string]struct {
+	site   string
+	evalue bool
+}{
+	"pfam":            {"pfam", true},
+	"cdd":             {"cdd", true},
+	"ncbifam":         {"ncbifam", true},
+	"tigrfam":         {"ncbifam", true},
+	"smart":           {"smart", true},
+	"prositeprofiles": {"profile", false},
+}
+
+// interProScanMotifs maps the InterProScan analyses that predict sequence
+// features to their motif type (see MotifNames).
+var interProScanMotifs = map[string]string{
+	"mobidblite":  "disorder",
+	"coils":       "coiled_coil",
+	"tmhmm":       "transmembrane",
+	"signalp":     "sig_p",
+	"signalp_euk": "sig_p",
+}
+
+// domainHit is a domain or motif read from a local annotation file.
+type domainHit struct {
+	protein  string
+	length   int     // protein length, 0 if not given
+	database string  // InterProScan analysis, empty for hmmscan hits
+	evalue   float64 // -1 if not given
+	start    int
+	end      int
+	motif    bool
+	feature  GraphicFeature
+}
+
+// GetLocalDomains reads the domains of a protein from an InterProScan TSV or
+// GFF3 file, or HMMER hmmscan --domtblout output, so that diagrams can be drawn
+// for proteins without a UniProt entry. The length of the protein is set from
+// the file if it is given there (hmmscan and InterProScan both report it), or
+// is "0" otherwise.
+func GetLocalDomains(filename string, opts *LocalDomainOptions) (*GraphicResponse, error) {
+	if opts == nil {
+		opts = &LocalDomainOptions{}
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var lines []string
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for s.Scan() {
+		lines = append(lines, s.Text())
+	}
+	if err = s.Err(); err != nil {
+		return nil, err
+	}
+
+	var hits []domainHit
+	switch detectDomainFormat(lines) {
+	case "gff3":
+		hits, err = parseInterProScanGFF3(lines)
+	case "tsv":
+		hits, err = parseInterProScanTSV(lines)
+	case "domtblout":
+		hits, err = parseDomTblOut(lines)
+	default:
+		err = fmt.Errorf("unknown format, expected InterProScan TSV/GFF3 or hmmscan --domtblout")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+
+	protein, err := selectHitProtein(hits, opts.Protein)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	database := opts.Domains
+	if database == "" {
+		database = "pfam"
+	}
+
+	g := &GraphicResponse{Length: "0"}
+	g.Metadata.Identifier = protein
+	var regions []domainHit
+	for _, h := range hits {
+		if h.protein != protein {
+			continue
+		}
+		if h.length > 0 {
+			g.Length = json.Number(fmt.Sprint(h.length))
+		}
+		if h.motif {
+			g.Motifs = append(g.Motifs, h.feature)
+			continue
+		}
+		if h.database != "" && database == "pfam" && h.database != "pfam" {
+			continue
+		}
+		if opts.MaxEValue > 0 && h.evalue > opts.MaxEValue {
+			continue
+		}
+		regions = append(regions, h)
+	}
+	if !opts.KeepOverlaps {
+		regions = resolveOverlaps(regions)
+	}
+	sort.Slice(regions, func(i, j int) bool {
+		if regions[i].start != regions[j].start {
+			return regions[i].start < regions[j].start
+		}
+		return regions[i].end < regions[j].end
+	})
+	for _, h := range regions {
+		h.feature.Color = DomainColor(h.feature.Metadata.Identifier, DomainPalette)
+		g.Regions = append(g.Regions, h.feature)
+	}
+	return g, nil
+}
+
+// detectDomainFormat guesses the format of an annotation file from its first
+// lines, returning "gff3", "tsv", "domtblout" or "" if it is unknown.
+func detectDomainFormat(lines []string) string {
+	for _, line := range lines {
+		if strings.HasPrefix(line, "##gff-version") {
+			return "gff3"
+		}
+		if strings.TrimSpace(line) == "" || line[0] == '#' {
+			continue
+		}
+		if len(strings.Split(line, "\t")) >= 11 {
+			return "tsv"
+		}
+		if len(strings.Fields(line)) >= 23 {
+			return "domtblout"
+		}
+		return ""
+	}
+	return ""
+}
+
+// selectHitProtein returns the protein to use hits for, which is either the
+// requested one or the only protein in hits.
+func selectHitProtein(hits []domainHit, protein string) (string, error) {
+	var proteins []string
+	for _, h := range hits {
+		if h.protein == protein {
+			return protein, nil
+		}
+		if !containsString(proteins, h.protein) {
+			proteins = append(proteins, h.protein)
+		}
+	}
+	switch len(proteins) {
+	case 0:
+		// a protein without any hits is not an error
+		return protein, nil
+	case 1:
+		return proteins[0], nil
+	}
+	if protein == "" {
+		return "", fmt.Errorf("hits for %d proteins (%s), please choose one", len(proteins), strings.Join(proteins, ", "))
+	}
+	return "", fmt.Errorf("no hits for '%s' (found %s)", protein, strings.Join(proteins, ", "))
+}
+
+// resolveOverlaps keeps the hits with the best E-values, dropping any hit
+// that overlaps a better hit by more than half of the shorter hit's length.
+// Hits without an E-value rank after those with one.
+func resolveOverlaps(hits []domainHit) []domainHit {
+	sorted := make([]domainHit, len(hits))
+	copy(sorted, hits)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		ei, ej := sorted[i].evalue, sorted[j].evalue
+		if (ei < 0) != (ej < 0) {
+			return ej < 0
+		}
+		return ei < ej
+	})
+
+	var res []domainHit
+	for _, h := range sorted {
+		keep := true
+		for _, k := range res {
+			overlap := minInt(h.end, k.end) - maxInt(h.start, k.start) + 1
+			shorter := minInt(h.end-h.start, k.end-k.start) + 1
+			if overlap*2 > shorter {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			res = append(res, h)
+		}
+	}
+	return res
+}
+
+// parseInterProScanTSV parses InterProScan's tab-separated output, where
+// the columns are protein, MD5, length, analysis, signature accession,
+// signature description, start, end, score, status, date, and optionally
+// the InterPro accession and description.
+func parseInterProScanTSV(lines []string) ([]domainHit, error) {
+	var hits []domainHit
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" || line[0] == '#' {
+			continue
+		}
+		p := strings.Split(line, "\t")
+		if len(p) < 11 {
+			return nil, fmt.Errorf("line %d: expected at least 11 columns", i+1)
+		}
+		length, err1 := strconv.Atoi(p[2])
+		start, err2 := strconv.Atoi(p[6])
+		end, err3 := strconv.Atoi(p[7])
+		if err1 != nil || err2 != nil || err3 != nil {
+			return nil, fmt.Errorf("line %d: invalid length or position", i+1)
+		}
+		var iprAcc, iprDesc string
+		if len(p) > 12 {
+			iprAcc, iprDesc = p[11], p[12]
+		}
+		h, ok := interProScanHit(p[0], p[3], p[4], p[5], p[8], iprAcc, iprDesc, start, end)
+		if ok {
+			h.length = length
+			hits = append(hits, h)
+		}
+	}
+	return hits, nil
+}
+
+// parseInterProScanGFF3 parses InterProScan's GFF3 output. Protein lengths
+// are taken from the ##sequence-region directives.
+func parseInterProScanGFF3(lines []string) ([]domainHit, error) {
+	lengths := make(map[string]int)
+	var hits []domainHit
+	for i, line := range lines {
+		if strings.HasPrefix(line, "##FASTA") {
+			// the translated sequences follow
+			break
+		}
+		if strings.HasPrefix(line, "##sequence-region") {
+			p := strings.Fields(line)
+			if len(p) == 4 {
+				lengths[p[1]], _ = strconv.Atoi(p[3])
+			}
+			continue
+		}
+		if strings.TrimSpace(line) == "" || line[0] == '#' {
+			continue
+		}
+		p := strings.Split(line, "\t")
+		if len(p) != 9 {
+			return nil, fmt.Errorf("line %d: expected 9 columns", i+1)
+		}
+		if p[2] != "protein_match" {
+			continue
+		}
+		start, err1 := strconv.Atoi(p[3])
+		end, err2 := strconv.Atoi(p[4])
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("line %d: invalid position", i+1)
+		}
+		attrs := make(map[string]string)
+		for _, kv := range strings.Split(p[8], ";") {
+			if k, v, ok := strings.Cut(kv, "="); ok {
+				v, err := url.PathUnescape(v)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: invalid attribute %s", i+1, k)
+				}
+				attrs[k] = v
+			}
+		}
+		iprAcc := ""
+		for _, x := range strings.Split(strings.Trim(attrs["Dbxref"], `"`), ",") {
+			if strings.HasPrefix(x, "InterPro:") {
+				iprAcc = strings.TrimPrefix(x, "InterPro:")
+			}
+		}
+		seqid, _ := url.PathUnescape(p[0])
+		h, ok := interProScanHit(seqid, p[1], attrs["Name"], attrs["signature_desc"], p[5], iprAcc, "", start, end)
+		if ok {
+			hits = append(hits, h)
+		}
+	}
+	for i := range hits {
+		hits[i].length = lengths[hits[i].protein]
+	}
+	return hits, nil
+}
+
+// interProScanHit creates a hit from the fields of an InterProScan match,
+// returning false if the analysis is not used for domains or motifs.
+func interProScanHit(protein, analysis, acc, desc, score, iprAcc, iprDesc string, start, end int) (domainHit, bool) {
+	analysis = strings.ToLower(analysis)
+	h := domainHit{
+		protein:  protein,
+		database: analysis,
+		evalue:   -1,
+		start:    start,
+		end:      end,
+	}
+	if mtype, ok := interProScanMotifs[analysis]; ok {
+		h.motif = true
+		h.feature = GraphicFeature{
+			Color: "#CCCCCC",
+			Type:  mtype,
+			Start: json.Number(fmt.Sprint(start)),
+			End:   json.Number(fmt.Sprint(end)),
+		}
+		return h, true
+	}
+	a, ok := interProScanAnalyses[analysis]
+	if !ok {
+		return h, false
+	}
+	if a.evalue {
+		if e, err := strconv.ParseFloat(score, 64); err == nil {
+			h.evalue = e
+		}
+	}
+	if desc == "" || desc == "-" {
+		desc = acc
+	}
+	h.feature = GraphicFeature{
+		Text:  desc,
+		Type:  "domain",
+		Start: json.Number(fmt.Sprint(start)),
+		End:   json.Number(fmt.Sprint(end)),
+		Link:  fmt.Sprintf(InterProLink, a.site, acc),
+		Metadata: GraphicMetadata{
+			Description: desc,
+			Identifier:  acc,
+		},
+	}
+	if iprDesc != "" && iprDesc != "-" {
+		h.feature.Metadata.Description = iprDesc
+	}
+	if iprAcc != "" && iprAcc != "-" {
+		h.feature.Link = fmt.Sprintf(InterProLink, "interpro", iprAcc)
+	}
+	return h, true
+}
+
+// parseDomTblOut parses the per-domain table written by hmmscan --domtblout,
+// where each target is a profile HMM and each query is a protein. Hits use
+// the independent E-value and the envelope coordinates.
+func parseDomTblOut(lines []string) ([]domainHit, error) {
+	var hits []domainHit
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" || line[0] == '#' {
+			continue
+		}
+		p := strings.Fields(line)
+		if len(p) < 23 {
+			return nil, fmt.Errorf("line %d: expected at least 23 columns", i+1)
+		}
+		length, err1 := strconv.Atoi(p[5])
+		evalue, err2 := strconv.ParseFloat(p[12], 64)
+		start, err3 := strconv.Atoi(p[19])
+		end, err4 := strconv.Atoi(p[20])
+		if err1 != nil || err2 != nil || err3 != nil || err4 != nil {
+			return nil, fmt.Errorf("line %d: invalid length, E-value or position", i+1)
+		}
+
+		name, acc := p[0], p[1]
+		if acc == "-" {
+			acc = name
+		}
+		// Pfam accessions are versioned, e.g. PF00870.21
+		if strings.HasPrefix(acc, "PF") {
+			acc, _, _ = strings.Cut(acc, ".")
+		}
+		desc := strings.Join(p[22:], " ")
+		if desc == "-" {
+			desc = name
+		}
+		gf := GraphicFeature{
+			Text:  name,
+			Type:  "domain",
+			Start: json.Number(fmt.Sprint(start)),
+			End:   json.Number(fmt.Sprint(end)),
+			Metadata: GraphicMetadata{
+				Description: desc,
+				Identifier:  acc,
+			},
+		}
+		if strings.HasPrefix(acc, "PF") {
+			gf.Link = fmt.Sprintf(InterProLink, "pfam", acc)
+		}
+		hits = append(hits, domainHit{
+			protein: p[3],
+			length:  length,
+			evalue:  evalue,
+			start:   start,
+			end:     end,
+			feature: gf,
+		})
+	}
+	return hits, nil
+}
+
+// GetLocalSequence reads the sequence with the given ID from a protein FASTA
+// file, returning its ID, the rest of its header line and the sequence. If
+// the file contains only one sequence, it is returned even if the ID does
+// not match. IDs such as "sp|P04637|P53_HUMAN" also match any of their parts.
+func GetLocalSequence(filename, id string) (string, string, string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", "", "", err
+	}
+	defer f.Close()
+
+	type record struct {
+		id, desc string
+		seq      strings.Builder
+	}
+	var records []*record
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == ';' {
+			continue
+		}
+		if line[0] == '>' {
+			r := &record{}
+			p := strings.SplitN(line[1:], " ", 2)
+			r.id = p[0]
+			if len(p) == 2 {
+				r.desc = strings.TrimSpace(p[1])
+			}
+			records = append(records, r)
+			continue
+		}
+		if len(records) == 0 {
+			return "", "", "", fmt.Errorf("%s: not a FASTA file", filename)
+		}
+		records[len(records)-1].seq.WriteString(strings.TrimSuffix(line, "*"))
+	}
+	if err = s.Err(); err != nil {
+		return "", "", "", err
+	}
+
+	for _, r := range records {
+		if r.id == id || containsString(strings.Split(r.id, "|"), id) {
+			return r.id, r.desc, r.seq.String(), nil
+		}
+	}
+	if len(records) == 1 {
+		r := records[0]
+		return r.id, r.desc, r.seq.String(), nil
+	}
+	return "", "", "", fmt.Errorf("%s: no sequence named '%s'", filename, id)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,172 @@
+//
+//    Lollipops diagram generation framework for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package data
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// UniProtTracks lists the UniProt feature types shown in each named track.
+var UniProtTracks = map[string][]string{
+	"ss":    {"Helix", "Beta strand", "Turn"},
+	"ptm":   {"Modified residue", "Glycosylation", "Lipidation", "Cross-link", "Disulfide bond"},
+	"sites": {"Active site", "Binding site", "Site"},
+}
+
+// UniProtTrackNames has human-readable names for the UniProtTracks.
+var UniProtTrackNames = map[string]string{
+	"ss":    "Secondary structure",
+	"ptm":   "Post-translational modifications",
+	"sites": "Sites",
+}
+
+// UniProtFeatureColors are the #RRGGBB colors used for each UniProt feature type.
+var UniProtFeatureColors = map[string]string{
+	"Helix":            "#E8495B",
+	"Beta strand":      "#F2B134",
+	"Turn":             "#4AA3DF",
+	"Modified residue": "#7B3294",
+	"Glycosylation":    "#1B9E77",
+	"Lipidation":       "#D95F02",
+	"Cross-link":       "#666666",
+	"Disulfide bond":   "#E6AB02",
+	"Active site":      "#D7191C",
+	"Binding site":     "#2C7BB6",
+	"Site":             "#A6611A",
+}
+
+// Tracks converts the features of a UniProt entry into the named tracks (see
+// UniProtTracks). Features with two linked positions (e.g. disulfide bonds)
+// are represented by a feature at each position.
+func (u *UniProtResponse) Tracks(names []string) ([]GraphicTrack, error) {
+	var res []GraphicTrack
+	for _, name := range names {
+		types, ok := UniProtTracks[name]
+		if !ok {
+			known := make([]string, 0, len(UniProtTracks))
+			for k := range UniProtTracks {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			return nil, fmt.Errorf("unknown track '%s' (available: %s)", name, strings.Join(known, ", "))
+		}
+
+		track := GraphicTrack{Name: UniProtTrackNames[name]}
+		for _, f := range u.Features {
+			if !containsString(types, f.Type) {
+				continue
+			}
+			start, end := f.Location.Start.Value, f.Location.End.Value
+			if start == 0 || end == 0 {
+				// unknown positions
+				continue
+			}
+			gf := GraphicFeature{
+				Color: UniProtFeatureColors[f.Type],
+				Text:  f.Description,
+				Type:  f.Type,
+				Metadata: GraphicMetadata{
+					Description: strings.TrimSpace(f.Type + " " + f.Description),
+				},
+			}
+			if f.Type == "Disulfide bond" {
+				for _, pos := range []int{start, end} {
+					gf.Start = json.Number(fmt.Sprint(pos))
+					gf.End = gf.Start
+					track.Features = append(track.Features, gf)
+				}
+				continue
+			}
+			gf.Start = json.Number(fmt.Sprint(start))
+			gf.End = json.Number(fmt.Sprint(end))
+			track.Features = append(track.Features, gf)
+		}
+		res = append(res, track)
+	}
+	return res, nil
+}
+
+// GetLocalTrack reads a custom annotation track from a tab-separated file with
+// start, end, label and (optionally) #RRGGBB color columns, in amino acid
+// coordinates. Blank lines, lines starting with '#', and a header line are
+// ignored. Features without a color are assigned one based on their label.
+func GetLocalTrack(name, filename string) (GraphicTrack, error) {
+	track := GraphicTrack{Name: name}
+	f, err := os.Open(filename)
+	if err != nil {
+		return track, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	lineno := 0
+	firstRow := true
+	for s.Scan() {
+		lineno++
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		p := strings.Split(line, "\t")
+		start, err1 := strconv.Atoi(strings.TrimSpace(p[0]))
+		if err1 != nil && firstRow {
+			// header line, possibly after some comments
+			firstRow = false
+			continue
+		}
+		firstRow = false
+		if len(p) < 3 {
+			return track, fmt.Errorf("%s:%d: expected start, end, label and color columns", filename, lineno)
+		}
+		end, err2 := strconv.Atoi(strings.TrimSpace(p[1]))
+		if err1 != nil || err2 != nil || end < start {
+			return track, fmt.Errorf("%s:%d: invalid start/end position", filename, lineno)
+		}
+		label := strings.TrimSpace(p[2])
+		color := DomainColor(label, DomainPalette)
+		if len(p) > 3 && strings.HasPrefix(strings.TrimSpace(p[3]), "#") {
+			color = strings.TrimSpace(p[3])
+		}
+		track.Features = append(track.Features, GraphicFeature{
+			Color: color,
+			Text:  label,
+			Type:  label,
+			Start: json.Number(fmt.Sprint(start)),
+			End:   json.Number(fmt.Sprint(end)),
+			Metadata: GraphicMetadata{
+				Description: fmt.Sprintf("%s (%d-%d)", label, start, end),
+			},
+		})
+	}
+	return track, s.Err()
+}
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
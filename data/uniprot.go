@@ -20,14 +20,14 @@ package data
 import (
 	"bytes"
 	"compress/gzip"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
-	"net"
-	"net/http"
 	"net/url"
 	"os"
+	"regexp"
 	"strings"
 )
 
@@ -49,91 +49,112 @@ func uniprotDecompress(respBytes []byte) []byte {
 	return respBytes
 }
 
-const UNIPROTRESTURL = "https://rest.uniprot.org/uniprotkb/search?query=%s+AND+reviewed:true+AND+organism_id:9606&format=tsv&fields=accession,gene_names,length"
+// UniProtCandidatesURL searches human UniProtKB entries by gene name (primary
+// or synonym), including unreviewed entries. Results are ordered by UniProt's
+// relevance score, which puts reviewed entries and exact gene name matches
+// first, so only the first page of 25 (the API's default size) is fetched:
+// it holds the useful candidates and keeps the -interactive list readable.
+const UniProtCandidatesURL = "https://rest.uniprot.org/uniprotkb/search?query=(gene:%s)+AND+organism_id:9606&format=tsv&fields=accession,reviewed,gene_primary,gene_synonym,length&size=25"
 
+// accessionPattern is the format of UniProtKB accessions (from
+// https://www.uniprot.org/help/accession_numbers), with an optional isoform.
+var accessionPattern = regexp.MustCompile(`^([OPQ][0-9][A-Z0-9]{3}[0-9]|[A-NR-Z][0-9]([A-Z][A-Z0-9]{2}[0-9]){1,2})(-[0-9]+)?$`)
+
+// IsUniProtAccession reports whether acc is a well-formed UniProtKB accession.
+func IsUniProtAccession(acc string) bool {
+	return accessionPattern.MatchString(acc)
+}
+
+// GetProtID is GetProtIDContext using context.Background().
 func GetProtID(symbol string) (string, error) {
-	apiURL := fmt.Sprintf(UNIPROTRESTURL, symbol)
-	resp, err := http.Get(apiURL)
-	if err != nil {
-		if err, ok := err.(net.Error); ok && err.Timeout() {
-			fmt.Fprintf(os.Stderr, "Unable to connect to Uniprot. Check your internet connection or try again later.")
-			os.Exit(1)
-		}
-		return "", err
-	}
-	defer resp.Body.Close()
-	respBytes, err := io.ReadAll(resp.Body)
+	return GetProtIDContext(context.Background(), symbol)
+}
+
+// GetProtIDContext looks up the best human UniProt accession for a gene
+// symbol, as ranked by GetProtCandidatesContext. If there are other equally
+// good candidates, they are listed on stderr. If no reviewed entry matches
+// the symbol, the unreviewed (TrEMBL) candidates are listed and an error is
+// returned, so that one of them is only used when chosen explicitly.
+func GetProtIDContext(ctx context.Context, symbol string) (string, error) {
+	cands, err := GetProtCandidatesContext(ctx, symbol)
 	if err != nil {
 		return "", err
 	}
-	respBytes = uniprotDecompress(respBytes)
-	if resp.StatusCode != 200 {
-		return "", fmt.Errorf("uniprot error: %s", resp.Status)
-	}
-	nmatches := 0
-	bestHit := 0
-	protID := ""
-	for i, line := range strings.Split(string(respBytes), "\n") {
-		if i == 0 {
-			continue
-		}
-		p := strings.Split(string(line), "\t")
-		for _, g := range strings.Split(string(p[1]), " ") {
-			if g == symbol {
-				// exact match, return immediately
-				return p[0], nil
-			}
-		}
-		n := strings.Count(line, symbol)
-		if n >= bestHit {
-			bestHit = n
-			protID = p[0]
-		}
-		nmatches++
+	return bestProtCandidate(symbol, cands)
+}
+
+// bestProtCandidate returns the first of the ranked candidates, listing any
+// equally good ones on stderr. It fails if the first one is unreviewed.
+func bestProtCandidate(symbol string, cands []ProtCandidate) (string, error) {
+	if len(cands) == 0 {
+		return "", fmt.Errorf("unable to find protein ID for '%s'", symbol)
 	}
-	fmt.Fprintf(os.Stderr, "Uniprot returned %d hits for your gene symbol '%s':\n", nmatches, symbol)
-	if nmatches > 1 {
-		fmt.Fprintln(os.Stderr, string(respBytes))
+	if !cands[0].Reviewed {
+		fmt.Fprintf(os.Stderr, "Uniprot has no reviewed entry for your gene symbol '%s', only:\n", symbol)
+		WriteProtCandidates(os.Stderr, cands)
+		fmt.Fprintln(os.Stderr)
+		return "", fmt.Errorf("no reviewed protein ID for '%s', give the accession of an unreviewed entry to use it (e.g. with -U XXX or -pick N)", symbol)
 	}
-	if bestHit == 0 {
-		fmt.Fprintf(os.Stderr, "Unable to find protein ID for '%s' (use -U XX to select one of the above)\n", symbol)
-		os.Exit(1)
-	} else if nmatches > 1 {
-		fmt.Fprintf(os.Stderr, "Selected '%s' as the best match. Use -U XXX to use another ID.\n\n", protID)
+	if len(cands) > 1 && !cands[0].Better(cands[1]) {
+		fmt.Fprintf(os.Stderr, "Uniprot returned %d hits for your gene symbol '%s':\n", len(cands), symbol)
+		WriteProtCandidates(os.Stderr, cands)
+		fmt.Fprintf(os.Stderr, "Selected '%s' as the best match. Use -U XXX or -pick N to use another ID.\n\n", cands[0].Accession)
 	}
-	return protID, nil
+	return cands[0].Accession, nil
 }
 
+// GetProtLength is GetProtLengthContext using context.Background().
 func GetProtLength(accession string) (int, error) {
-	apiURL := fmt.Sprintf("https://rest.uniprot.org/uniprotkb/%s.json", accession)
-	resp, err := http.Get(apiURL)
+	return GetProtLengthContext(context.Background(), accession)
+}
+
+// GetProtLengthContext returns the sequence length of a UniProt entry.
+func GetProtLengthContext(ctx context.Context, accession string) (int, error) {
+	entry, err := GetUniProtEntryContext(ctx, accession)
 	if err != nil {
-		if err, ok := err.(net.Error); ok && err.Timeout() {
-			fmt.Fprintf(os.Stderr, "Unable to connect to Uniprot. Check your internet connection or try again later.")
-			os.Exit(1)
-		}
 		return 0, err
 	}
+	return entry.Sequence.Length, nil
+}
+
+// GetUniProtEntry is GetUniProtEntryContext using context.Background().
+func GetUniProtEntry(accession string) (*UniProtResponse, error) {
+	return GetUniProtEntryContext(context.Background(), accession)
+}
+
+// GetUniProtEntryContext fetches the full UniProtKB entry for accession.
+func GetUniProtEntryContext(ctx context.Context, accession string) (*UniProtResponse, error) {
+	apiURL := fmt.Sprintf("https://rest.uniprot.org/uniprotkb/%s.json", accession)
+	resp, err := httpGet(ctx, apiURL)
+	if err != nil {
+		return nil, connectError("Uniprot", err)
+	}
 	defer resp.Body.Close()
 	respBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	respBytes = uniprotDecompress(respBytes)
 	if resp.StatusCode != 200 {
-		return 0, fmt.Errorf("uniprot error: %s", resp.Status)
+		return nil, fmt.Errorf("uniprot error: %s", resp.Status)
 	}
 
-	data := UniProtResponse{}
-	err = json.Unmarshal(respBytes, &data)
+	data := &UniProtResponse{}
+	err = json.Unmarshal(respBytes, data)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-
-	return data.Sequence.Length, nil
+	return data, nil
 }
 
+// GetProtMapping is GetProtMappingContext using context.Background().
 func GetProtMapping(dbname, geneid string) (string, error) {
+	return GetProtMappingContext(context.Background(), dbname, geneid)
+}
+
+// GetProtMappingContext maps an identifier from the dbname database to a
+// UniProt accession.
+func GetProtMappingContext(ctx context.Context, dbname, geneid string) (string, error) {
 	apiURL := `https://www.uniprot.org/uploadlists/`
 	params := url.Values{
 		"from":   {dbname},
@@ -142,13 +163,9 @@ func GetProtMapping(dbname, geneid string) (string, error) {
 		"format": {"tab"},
 	}
 
-	resp, err := httpPostForm(apiURL, params)
+	resp, err := httpPostForm(ctx, apiURL, params)
 	if err != nil {
-		if err, ok := err.(net.Error); ok && err.Timeout() {
-			fmt.Fprintf(os.Stderr, "Unable to connect to Uniprot. Check your internet connection or try again later.")
-			os.Exit(1)
-		}
-		return "", err
+		return "", connectError("Uniprot", err)
 	}
 	defer resp.Body.Close()
 	if resp.StatusCode != 200 {
@@ -179,3 +196,68 @@ func GetProtMapping(dbname, geneid string) (string, error) {
 	}
 	return protID, nil
 }
+
+// uniprotDomainTypes are the feature types used as domains by Domains.
+var uniprotDomainTypes = []string{"Domain", "Repeat", "Zinc finger"}
+
+// uniprotMotifTypes maps feature types to the motif types used by Motifs
+// (see MotifNames).
+var uniprotMotifTypes = map[string]string{
+	"Transmembrane":      "transmembrane",
+	"Signal":             "sig_p",
+	"Coiled coil":        "coiled_coil",
+	"Compositional bias": "low_complexity",
+}
+
+// Domains returns the domain, repeat and zinc finger features of the entry.
+// Numbered repeats (e.g. "WD 1", "WD 2") are given the same color.
+func (u *UniProtResponse) Domains() []GraphicFeature {
+	var gs []GraphicFeature
+	for _, f := range u.Features {
+		if !containsString(uniprotDomainTypes, f.Type) || f.Location.Start.Value == 0 || f.Location.End.Value == 0 {
+			continue
+		}
+		if f.Description == "" {
+			f.Description = f.Type
+		}
+		name := strings.TrimRight(f.Description, " 0123456789")
+		if name == "" {
+			name = f.Description
+		}
+		gs = append(gs, GraphicFeature{
+			Color: DomainColor(name, DomainPalette),
+			Text:  f.Description,
+			Type:  strings.ToLower(f.Type),
+			Start: json.Number(fmt.Sprint(f.Location.Start.Value)),
+			End:   json.Number(fmt.Sprint(f.Location.End.Value)),
+			Link:  fmt.Sprintf("https://www.uniprot.org/uniprotkb/%s/entry#family_and_domains", u.PrimaryAccession),
+			Metadata: GraphicMetadata{
+				Description: f.Description,
+				Identifier:  name,
+			},
+		})
+	}
+	return gs
+}
+
+// Motifs returns the transmembrane, signal peptide, coiled-coil, low
+// complexity and disordered regions of the entry.
+func (u *UniProtResponse) Motifs() []GraphicFeature {
+	var gs []GraphicFeature
+	for _, f := range u.Features {
+		mtype, ok := uniprotMotifTypes[f.Type]
+		if f.Type == "Region" && f.Description == "Disordered" {
+			mtype, ok = "disorder", true
+		}
+		if !ok || f.Location.Start.Value == 0 || f.Location.End.Value == 0 {
+			continue
+		}
+		gs = append(gs, GraphicFeature{
+			Color: "#CCCCCC",
+			Type:  mtype,
+			Start: json.Number(fmt.Sprint(f.Location.Start.Value)),
+			End:   json.Number(fmt.Sprint(f.Location.End.Value)),
+		})
+	}
+	return gs
+}
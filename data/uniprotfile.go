@@ -0,0 +1,837 @@
+//
+//    Lollipops diagram generation framework for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package data
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// UniProtFile reads entries from a local UniProtKB flat file (.dat) or XML
+// file, which may hold a whole release. The position of each entry is indexed
+// when the file is opened. The index can be saved next to the file (as
+// FILE.idx), to be reused until the file is modified, and is otherwise kept
+// in memory only. Compressed files must
+// be compressed with bgzip, so that each entry can be read without
+// decompressing the file up to it.
+//
+// A UniProtFile is safe for concurrent use.
+type UniProtFile struct {
+	filename string
+	xml      bool
+	// bgzf is set for BGZF compressed files, whose offsets are virtual.
+	bgzf    bool
+	entries []uniprotIndexEntry
+	byID    map[string]int
+}
+
+// uniprotIndexEntry is the position and gene names of an entry in a
+// UniProtFile.
+type uniprotIndexEntry struct {
+	offset    int64
+	ids       []string // the accessions, primary first, and the entry name
+	taxonID   int
+	candidate ProtCandidate
+}
+
+const uniprotIndexHeader = "#lollipops uniprot index v2"
+
+// errStopScan stops scanUniProtText and scanUniProtXML early.
+var errStopScan = errors.New("stop scan")
+
+// OpenUniProtFile opens and indexes a UniProtKB flat file or XML file. An
+// up to date FILE.idx is always used, and if saveIndex is set a new index is
+// written to it. If it cannot be written, a warning is printed and the index
+// is kept in memory.
+func OpenUniProtFile(filename string, saveIndex bool) (*UniProtFile, error) {
+	f := &UniProtFile{filename: filename}
+	fp, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(fp, head)
+	fp.Close()
+	if n >= 2 && head[0] == 0x1f && head[1] == 0x8b {
+		if _, ok := bgzfBlockSize(head[:n]); !ok {
+			return nil, fmt.Errorf("%s: gzip files must be compressed with bgzip to be read, please decompress it or recompress it with bgzip", filename)
+		}
+		f.bgzf = true
+		r, err := f.open(0)
+		if err != nil {
+			return nil, err
+		}
+		n, _ = io.ReadFull(r, head)
+		r.Close()
+	}
+	head = bytes.TrimSpace(head[:n])
+	switch {
+	case bytes.HasPrefix(head, []byte("<")):
+		f.xml = true
+	case bytes.HasPrefix(head, []byte("ID   ")):
+	default:
+		return nil, fmt.Errorf("%s: not a UniProtKB flat file or XML file", filename)
+	}
+
+	if err = f.loadIndex(); err != nil {
+		if saveIndex {
+			fmt.Fprintf(os.Stderr, "Indexing %s to %s.idx ...\n", filename, filename)
+		} else {
+			fmt.Fprintf(os.Stderr, "Indexing %s in memory ...\n", filename)
+		}
+		if err = f.buildIndex(); err != nil {
+			return nil, fmt.Errorf("%s: %s", filename, err)
+		}
+		// the index only saves time later, so the directory may be read-only
+		if saveIndex {
+			if err = f.saveIndex(); err != nil {
+				fmt.Fprintf(os.Stderr, "WARNING: unable to save the index, keeping it in memory: %s\n", err)
+			}
+		}
+	}
+
+	// primary accessions take precedence over secondary accessions
+	f.byID = make(map[string]int)
+	for i, e := range f.entries {
+		f.byID[strings.ToUpper(e.ids[0])] = i
+	}
+	for i, e := range f.entries {
+		for _, id := range e.ids[1:] {
+			if _, ok := f.byID[strings.ToUpper(id)]; !ok {
+				f.byID[strings.ToUpper(id)] = i
+			}
+		}
+	}
+	return f, nil
+}
+
+// Entry reads the entry for a primary or secondary accession, or an entry
+// name such as P53_HUMAN.
+func (f *UniProtFile) Entry(accession string) (*UniProtResponse, error) {
+	i, ok := f.byID[strings.ToUpper(accession)]
+	if !ok {
+		return nil, fmt.Errorf("%s: no entry for '%s'", f.filename, accession)
+	}
+	r, err := f.open(f.entries[i].offset)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	var entry *UniProtResponse
+	scan := scanUniProtText
+	if f.xml {
+		scan = scanUniProtXML
+	}
+	err = scan(r, func(_ int64, u *UniProtResponse) error {
+		entry = u
+		return errStopScan
+	})
+	if err != nil && err != errStopScan {
+		return nil, fmt.Errorf("%s: %s", f.filename, err)
+	}
+	if entry == nil {
+		return nil, fmt.Errorf("%s: the index is out of date, please remove %s.idx", f.filename, f.filename)
+	}
+	return entry, nil
+}
+
+// Candidates returns the entries of an organism (or of every organism if
+// taxonID is 0) with the gene symbol as a primary gene name or synonym,
+// ranked as by GetProtCandidates.
+func (f *UniProtFile) Candidates(symbol string, taxonID int) []ProtCandidate {
+	var res []ProtCandidate
+	for _, e := range f.entries {
+		if taxonID != 0 && e.taxonID != taxonID {
+			continue
+		}
+		c := e.candidate
+		c.setMatch(symbol)
+		if c.Match != MatchOther {
+			res = append(res, c)
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Better(res[j])
+	})
+	return res
+}
+
+// GetProtID returns the best human entry for a gene symbol, as ranked by
+// Candidates. If there are other equally good candidates, they are listed on
+// stderr. As with GetProtIDContext, it fails if no reviewed entry matches.
+func (f *UniProtFile) GetProtID(symbol string) (string, error) {
+	return bestProtCandidate(symbol, f.Candidates(symbol, 9606))
+}
+
+// open returns a reader for the (uncompressed) file starting at offset,
+// which is a virtual offset for BGZF files.
+func (f *UniProtFile) open(offset int64) (io.ReadCloser, error) {
+	fp, err := os.Open(f.filename)
+	if err != nil {
+		return nil, err
+	}
+	if !f.bgzf {
+		if _, err = fp.Seek(offset, io.SeekStart); err != nil {
+			fp.Close()
+			return nil, err
+		}
+		return fp, nil
+	}
+	// only the rest of the entry's block needs to be skipped
+	_, err = fp.Seek(offset>>16, io.SeekStart)
+	var zr *gzip.Reader
+	if err == nil {
+		zr, err = gzip.NewReader(fp)
+	}
+	if err == nil {
+		_, err = io.CopyN(io.Discard, zr, offset&0xffff)
+	}
+	if err != nil {
+		fp.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{zr, fp}, nil
+}
+
+// buildIndex reads every entry in the file.
+func (f *UniProtFile) buildIndex() error {
+	fp, err := os.Open(f.filename)
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	var r io.Reader = fp
+	var bz *bgzfReader
+	if f.bgzf {
+		bz = &bgzfReader{r: bufio.NewReader(fp)}
+		r = bz
+	}
+	scan := scanUniProtText
+	if f.xml {
+		scan = scanUniProtXML
+	}
+	f.entries = nil
+	return scan(r, func(offset int64, u *UniProtResponse) error {
+		if bz != nil {
+			offset = bz.virtualOffset(offset)
+		}
+		e := uniprotIndexEntry{
+			offset:  offset,
+			ids:     append([]string{u.PrimaryAccession}, u.SecondaryAccessions...),
+			taxonID: u.Organism.TaxonID,
+			candidate: ProtCandidate{
+				Accession: u.PrimaryAccession,
+				Length:    u.Sequence.Length,
+				Reviewed:  strings.HasPrefix(u.EntryType, "UniProtKB reviewed"),
+			},
+		}
+		if u.UniProtKBID != "" {
+			e.ids = append(e.ids, u.UniProtKBID)
+		}
+		var names []string
+		for _, g := range u.Genes {
+			if g.GeneName.Value != "" {
+				names = append(names, g.GeneName.Value)
+			}
+			for _, s := range g.Synonyms {
+				e.candidate.Synonyms = append(e.candidate.Synonyms, s.Value)
+			}
+		}
+		e.candidate.GeneName = strings.Join(names, "; ")
+		f.entries = append(f.entries, e)
+		return nil
+	})
+}
+
+// loadIndex reads the saved index, if it is newer than the file.
+func (f *UniProtFile) loadIndex() error {
+	st, err := os.Stat(f.filename)
+	if err != nil {
+		return err
+	}
+	ist, err := os.Stat(f.filename + ".idx")
+	if err != nil {
+		return err
+	}
+	if ist.ModTime().Before(st.ModTime()) {
+		return fmt.Errorf("%s.idx is out of date", f.filename)
+	}
+	fp, err := os.Open(f.filename + ".idx")
+	if err != nil {
+		return err
+	}
+	defer fp.Close()
+
+	s := bufio.NewScanner(fp)
+	if !s.Scan() || s.Text() != uniprotIndexHeader {
+		return fmt.Errorf("%s.idx is not a lollipops index", f.filename)
+	}
+	f.entries = nil
+	for s.Scan() {
+		// offset, ids, taxon, reviewed, length, gene names, synonyms
+		p := strings.Split(s.Text(), "\t")
+		if len(p) != 7 {
+			return fmt.Errorf("%s.idx is invalid", f.filename)
+		}
+		e := uniprotIndexEntry{ids: strings.Split(p[1], ",")}
+		e.offset, err = strconv.ParseInt(p[0], 10, 64)
+		if err != nil {
+			return err
+		}
+		e.taxonID, _ = strconv.Atoi(p[2])
+		e.candidate.Accession = e.ids[0]
+		e.candidate.Reviewed = p[3] == "1"
+		e.candidate.Length, _ = strconv.Atoi(p[4])
+		e.candidate.GeneName = p[5]
+		if p[6] != "" {
+			e.candidate.Synonyms = strings.Split(p[6], ";")
+		}
+		f.entries = append(f.entries, e)
+	}
+	return s.Err()
+}
+
+// saveIndex writes the index next to the file.
+func (f *UniProtFile) saveIndex() error {
+	fp, err := os.Create(f.filename + ".idx")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(fp)
+	fmt.Fprintln(w, uniprotIndexHeader)
+	for _, e := range f.entries {
+		reviewed := 0
+		if e.candidate.Reviewed {
+			reviewed = 1
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%d\t%s\t%s\n", e.offset, strings.Join(e.ids, ","), e.taxonID,
+			reviewed, e.candidate.Length, e.candidate.GeneName, strings.Join(e.candidate.Synonyms, ";"))
+	}
+	err = w.Flush()
+	if cerr := fp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.filename + ".idx")
+	}
+	return err
+}
+
+// uniprotTextFeatureTypes maps flat file feature keys to the feature types
+// used by the UniProt REST API.
+var uniprotTextFeatureTypes = map[string]string{
+	"INIT_MET": "Initiator methionine",
+	"SIGNAL":   "Signal",
+	"PROPEP":   "Propeptide",
+	"TRANSIT":  "Transit peptide",
+	"CHAIN":    "Chain",
+	"PEPTIDE":  "Peptide",
+	"TOPO_DOM": "Topological domain",
+	"TRANSMEM": "Transmembrane",
+	"INTRAMEM": "Intramembrane",
+	"DOMAIN":   "Domain",
+	"REPEAT":   "Repeat",
+	"ZN_FING":  "Zinc finger",
+	"DNA_BIND": "DNA binding",
+	"REGION":   "Region",
+	"COILED":   "Coiled coil",
+	"MOTIF":    "Motif",
+	"COMPBIAS": "Compositional bias",
+	"ACT_SITE": "Active site",
+	"BINDING":  "Binding site",
+	"SITE":     "Site",
+	"NON_STD":  "Non-standard residue",
+	"MOD_RES":  "Modified residue",
+	"LIPID":    "Lipidation",
+	"CARBOHYD": "Glycosylation",
+	"DISULFID": "Disulfide bond",
+	"CROSSLNK": "Cross-link",
+	"VAR_SEQ":  "Alternative sequence",
+	"VARIANT":  "Natural variant",
+	"MUTAGEN":  "Mutagenesis",
+	"UNSURE":   "Sequence uncertainty",
+	"CONFLICT": "Sequence conflict",
+	"NON_CONS": "Non-adjacent residues",
+	"NON_TER":  "Non-terminal residue",
+	"HELIX":    "Helix",
+	"STRAND":   "Beta strand",
+	"TURN":     "Turn",
+}
+
+// uniprotXMLFeatureTypes maps XML feature types to the feature types used
+// by the UniProt REST API.
+var uniprotXMLFeatureTypes = map[string]string{
+	"initiator methionine":          "Initiator methionine",
+	"signal peptide":                "Signal",
+	"propeptide":                    "Propeptide",
+	"transit peptide":               "Transit peptide",
+	"chain":                         "Chain",
+	"peptide":                       "Peptide",
+	"topological domain":            "Topological domain",
+	"transmembrane region":          "Transmembrane",
+	"intramembrane region":          "Intramembrane",
+	"domain":                        "Domain",
+	"repeat":                        "Repeat",
+	"zinc finger region":            "Zinc finger",
+	"DNA-binding region":            "DNA binding",
+	"region of interest":            "Region",
+	"coiled-coil region":            "Coiled coil",
+	"short sequence motif":          "Motif",
+	"compositionally biased region": "Compositional bias",
+	"active site":                   "Active site",
+	"binding site":                  "Binding site",
+	"site":                          "Site",
+	"non-standard amino acid":       "Non-standard residue",
+	"modified residue":              "Modified residue",
+	"lipid moiety-binding region":   "Lipidation",
+	"glycosylation site":            "Glycosylation",
+	"disulfide bond":                "Disulfide bond",
+	"cross-link":                    "Cross-link",
+	"splice variant":                "Alternative sequence",
+	"sequence variant":              "Natural variant",
+	"mutagenesis site":              "Mutagenesis",
+	"unsure residue":                "Sequence uncertainty",
+	"sequence conflict":             "Sequence conflict",
+	"non-consecutive residues":      "Non-adjacent residues",
+	"non-terminal residue":          "Non-terminal residue",
+	"helix":                         "Helix",
+	"strand":                        "Beta strand",
+	"turn":                          "Turn",
+}
+
+// evidencePattern matches the evidence tags in flat file lines.
+var evidencePattern = regexp.MustCompile(`\s*\{[^}]*\}`)
+
+// scanUniProtText calls fn with the offset and contents of each entry read
+// from a UniProtKB flat file.
+func scanUniProtText(r io.Reader, fn func(int64, *UniProtResponse) error) error {
+	br := bufio.NewReaderSize(r, 1<<16)
+	var offset, start int64
+	var lines []string
+	for {
+		line, err := br.ReadString('\n')
+		if len(line) > 0 {
+			if len(lines) == 0 {
+				start = offset
+			}
+			offset += int64(len(line))
+			line = strings.TrimRight(line, "\r\n")
+			if strings.HasPrefix(line, "//") {
+				u, perr := parseUniProtText(lines)
+				if perr != nil {
+					return fmt.Errorf("entry at byte %d: %s", start, perr)
+				}
+				if ferr := fn(start, u); ferr != nil {
+					return ferr
+				}
+				lines = lines[:0]
+			} else if len(lines) > 0 || strings.TrimSpace(line) != "" {
+				lines = append(lines, line)
+			}
+		}
+		if err == io.EOF {
+			if len(lines) > 0 {
+				return fmt.Errorf("entry at byte %d is incomplete", start)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// parseUniProtText parses the lines of a flat file entry (without the
+// terminating "//" line).
+func parseUniProtText(lines []string) (*UniProtResponse, error) {
+	u := &UniProtResponse{}
+	var gn, org, seq strings.Builder
+	inSeq := false
+	deDone := false
+	var ft *UniProtFeature
+	qualifier, value := "", ""
+
+	// finishQualifier stores the description of the current feature
+	finishQualifier := func() {
+		if ft != nil && (qualifier == "note" || (qualifier == "ligand" && ft.Description == "")) {
+			ft.Description = strings.Trim(value, `"`)
+		}
+		qualifier, value = "", ""
+	}
+
+	for _, line := range lines {
+		if inSeq {
+			seq.WriteString(strings.Replace(line, " ", "", -1))
+			continue
+		}
+		if len(line) < 2 {
+			continue
+		}
+		text := ""
+		if len(line) > 5 {
+			text = line[5:]
+		}
+		switch line[:2] {
+		case "ID":
+			p := strings.Fields(text)
+			if len(p) < 2 {
+				return nil, fmt.Errorf("invalid ID line")
+			}
+			u.UniProtKBID = p[0]
+			u.EntryType = "UniProtKB unreviewed (TrEMBL)"
+			if strings.HasPrefix(p[1], "Reviewed") {
+				u.EntryType = "UniProtKB reviewed (Swiss-Prot)"
+			}
+		case "AC":
+			for _, acc := range strings.Split(text, ";") {
+				if acc = strings.TrimSpace(acc); acc == "" {
+					continue
+				}
+				if u.PrimaryAccession == "" {
+					u.PrimaryAccession = acc
+				} else {
+					u.SecondaryAccessions = append(u.SecondaryAccessions, acc)
+				}
+			}
+		case "DT":
+			text = strings.TrimSuffix(strings.TrimSpace(text), ".")
+			if i := strings.Index(text, "entry version "); i != -1 {
+				u.EntryAudit.EntryVersion, _ = strconv.Atoi(text[i+14:])
+			}
+			if i := strings.Index(text, "sequence version "); i != -1 {
+				u.EntryAudit.SequenceVersion, _ = strconv.Atoi(text[i+17:])
+			}
+		case "DE":
+			text = strings.TrimSpace(text)
+			if text == "Contains:" || text == "Includes:" {
+				// the names of the parts of the protein follow
+				deDone = true
+			}
+			if deDone {
+				continue
+			}
+			name := strings.TrimSuffix(evidencePattern.ReplaceAllString(text, ""), ";")
+			if strings.HasPrefix(name, "RecName: Full=") {
+				u.ProteinDescription.RecommendedName.FullName.Value = strings.TrimPrefix(name, "RecName: Full=")
+			} else if strings.HasPrefix(name, "SubName: Full=") {
+				u.ProteinDescription.SubmissionNames = append(u.ProteinDescription.SubmissionNames,
+					UniProtName{FullName: UniProtValue{strings.TrimPrefix(name, "SubName: Full=")}})
+			}
+		case "GN":
+			gn.WriteString(text + " ")
+		case "OS":
+			org.WriteString(text + " ")
+		case "OX":
+			if i := strings.Index(text, "NCBI_TaxID="); i != -1 {
+				id := strings.TrimLeft(text[i+11:], " ")
+				if j := strings.IndexFunc(id, func(r rune) bool { return r < '0' || r > '9' }); j != -1 {
+					id = id[:j]
+				}
+				u.Organism.TaxonID, _ = strconv.Atoi(id)
+			}
+		case "FT":
+			if len(text) > 0 && text[0] != ' ' {
+				// a new feature: the key is in columns 6-21, then its location
+				finishQualifier()
+				ft = nil
+				if len(text) < 16 {
+					continue
+				}
+				key := strings.TrimSpace(text[:16])
+				loc, ok := parseUniProtLocation(strings.TrimSpace(text[16:]))
+				if !ok {
+					continue
+				}
+				ftype, ok := uniprotTextFeatureTypes[key]
+				if !ok {
+					ftype = key
+				}
+				u.Features = append(u.Features, UniProtFeature{Type: ftype, Location: loc})
+				ft = &u.Features[len(u.Features)-1]
+				continue
+			}
+			text = strings.TrimSpace(text)
+			quoted := strings.HasPrefix(value, `"`) && (len(value) == 1 || !strings.HasSuffix(value, `"`))
+			if strings.HasPrefix(text, "/") && !quoted {
+				finishQualifier()
+				p := strings.SplitN(text[1:], "=", 2)
+				qualifier = p[0]
+				if len(p) == 2 {
+					value = p[1]
+				}
+			} else if qualifier != "" {
+				// a quoted value continued from the previous line
+				value += " " + text
+			}
+		case "SQ":
+			finishQualifier()
+			inSeq = true
+		}
+	}
+	finishQualifier()
+	if u.PrimaryAccession == "" {
+		return nil, fmt.Errorf("no AC line")
+	}
+	u.Sequence.Value = seq.String()
+	u.Sequence.Length = len(u.Sequence.Value)
+
+	// genes are separated by "and" lines, and names within a gene by ";"
+	var gene *UniProtGene
+	for _, part := range strings.Split(evidencePattern.ReplaceAllString(gn.String(), ""), ";") {
+		part = strings.TrimSpace(part)
+		if strings.HasPrefix(part, "and ") || part == "and" {
+			gene = nil
+			part = strings.TrimSpace(strings.TrimPrefix(part, "and"))
+		}
+		p := strings.SplitN(part, "=", 2)
+		if len(p) != 2 {
+			continue
+		}
+		if gene == nil || (p[0] == "Name" && gene.GeneName.Value != "") {
+			u.Genes = append(u.Genes, UniProtGene{})
+			gene = &u.Genes[len(u.Genes)-1]
+		}
+		switch p[0] {
+		case "Name":
+			gene.GeneName.Value = p[1]
+		case "Synonyms":
+			for _, s := range strings.Split(p[1], ",") {
+				gene.Synonyms = append(gene.Synonyms, UniProtValue{strings.TrimSpace(s)})
+			}
+		}
+	}
+
+	// e.g. "Homo sapiens (Human)."
+	organism := strings.TrimSuffix(strings.TrimSpace(org.String()), ".")
+	if i := strings.Index(organism, " ("); i != -1 {
+		u.Organism.CommonName = strings.TrimSuffix(organism[i+2:], ")")
+		organism = organism[:i]
+	}
+	u.Organism.ScientificName = organism
+	return u, nil
+}
+
+// parseUniProtLocation parses a flat file feature location such as "15",
+// "1..83" or "<1..>10". Locations on other sequences are not supported.
+func parseUniProtLocation(s string) (UniProtLocation, bool) {
+	var loc UniProtLocation
+	if strings.Contains(s, ":") {
+		return loc, false
+	}
+	p := strings.SplitN(s, "..", 2)
+	if len(p) == 1 {
+		p = append(p, p[0])
+	}
+	positions := []*UniProtPosition{&loc.Start, &loc.End}
+	for i, pos := range positions {
+		x := p[i]
+		pos.Modifier = "EXACT"
+		switch {
+		case strings.HasPrefix(x, "<") || strings.HasPrefix(x, ">"):
+			pos.Modifier = "OUTSIDE"
+			x = x[1:]
+		case x == "?":
+			pos.Modifier = "UNKNOWN"
+			continue
+		case strings.HasPrefix(x, "?"):
+			pos.Modifier = "UNSURE"
+			x = x[1:]
+		}
+		v, err := strconv.Atoi(x)
+		if err != nil {
+			return loc, false
+		}
+		pos.Value = v
+	}
+	return loc, true
+}
+
+// uniprotXMLName is a name with a type attribute, e.g. a gene name.
+type uniprotXMLName struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// uniprotXMLPosition is the begin, end or position of a feature location.
+type uniprotXMLPosition struct {
+	Position string `xml:"position,attr"`
+	Status   string `xml:"status,attr"`
+}
+
+func (p uniprotXMLPosition) position() UniProtPosition {
+	pos := UniProtPosition{Modifier: "EXACT"}
+	pos.Value, _ = strconv.Atoi(p.Position)
+	switch p.Status {
+	case "less than", "greater than":
+		pos.Modifier = "OUTSIDE"
+	case "uncertain":
+		pos.Modifier = "UNSURE"
+	case "unknown":
+		pos.Modifier = "UNKNOWN"
+	}
+	return pos
+}
+
+// uniprotXMLEntry is an entry element of a UniProtKB XML file.
+type uniprotXMLEntry struct {
+	Dataset         string   `xml:"dataset,attr"`
+	Version         int      `xml:"version,attr"`
+	Accessions      []string `xml:"accession"`
+	Name            string   `xml:"name"`
+	RecommendedName string   `xml:"protein>recommendedName>fullName"`
+	SubmittedNames  []string `xml:"protein>submittedName>fullName"`
+	Genes           []struct {
+		Names []uniprotXMLName `xml:"name"`
+	} `xml:"gene"`
+	Organism struct {
+		Names      []uniprotXMLName `xml:"name"`
+		References []struct {
+			Type string `xml:"type,attr"`
+			ID   string `xml:"id,attr"`
+		} `xml:"dbReference"`
+	} `xml:"organism"`
+	Features []struct {
+		Type        string `xml:"type,attr"`
+		Description string `xml:"description,attr"`
+		Location    struct {
+			Begin    *uniprotXMLPosition `xml:"begin"`
+			End      *uniprotXMLPosition `xml:"end"`
+			Position *uniprotXMLPosition `xml:"position"`
+			Sequence string              `xml:"sequence,attr"`
+		} `xml:"location"`
+	} `xml:"feature"`
+	Sequence struct {
+		Version int    `xml:"version,attr"`
+		Value   string `xml:",chardata"`
+	} `xml:"sequence"`
+}
+
+// response converts the entry into the form returned by the UniProt REST API.
+func (e *uniprotXMLEntry) response() *UniProtResponse {
+	u := &UniProtResponse{
+		UniProtKBID: e.Name,
+		EntryType:   "UniProtKB unreviewed (TrEMBL)",
+	}
+	if e.Dataset == "Swiss-Prot" {
+		u.EntryType = "UniProtKB reviewed (Swiss-Prot)"
+	}
+	if len(e.Accessions) > 0 {
+		u.PrimaryAccession = e.Accessions[0]
+		u.SecondaryAccessions = e.Accessions[1:]
+	}
+	u.ProteinDescription.RecommendedName.FullName.Value = e.RecommendedName
+	for _, name := range e.SubmittedNames {
+		u.ProteinDescription.SubmissionNames = append(u.ProteinDescription.SubmissionNames,
+			UniProtName{FullName: UniProtValue{name}})
+	}
+	for _, g := range e.Genes {
+		var gene UniProtGene
+		for _, n := range g.Names {
+			switch n.Type {
+			case "primary":
+				gene.GeneName.Value = n.Value
+			case "synonym":
+				gene.Synonyms = append(gene.Synonyms, UniProtValue{n.Value})
+			}
+		}
+		u.Genes = append(u.Genes, gene)
+	}
+	for _, n := range e.Organism.Names {
+		switch n.Type {
+		case "scientific":
+			u.Organism.ScientificName = n.Value
+		case "common":
+			u.Organism.CommonName = n.Value
+		}
+	}
+	for _, ref := range e.Organism.References {
+		if ref.Type == "NCBI Taxonomy" {
+			u.Organism.TaxonID, _ = strconv.Atoi(ref.ID)
+		}
+	}
+	for _, f := range e.Features {
+		l := f.Location
+		if l.Sequence != "" {
+			// located on another isoform
+			continue
+		}
+		ftype, ok := uniprotXMLFeatureTypes[f.Type]
+		if !ok {
+			ftype = f.Type
+		}
+		uf := UniProtFeature{Type: ftype, Description: f.Description}
+		switch {
+		case l.Position != nil:
+			uf.Location.Start = l.Position.position()
+			uf.Location.End = uf.Location.Start
+		case l.Begin != nil && l.End != nil:
+			uf.Location.Start = l.Begin.position()
+			uf.Location.End = l.End.position()
+		default:
+			continue
+		}
+		u.Features = append(u.Features, uf)
+	}
+	u.EntryAudit.EntryVersion = e.Version
+	u.EntryAudit.SequenceVersion = e.Sequence.Version
+	u.Sequence.Value = strings.Join(strings.Fields(e.Sequence.Value), "")
+	u.Sequence.Length = len(u.Sequence.Value)
+	return u
+}
+
+// scanUniProtXML calls fn with the offset and contents of each entry read
+// from a UniProtKB XML file.
+func scanUniProtXML(r io.Reader, fn func(int64, *UniProtResponse) error) error {
+	d := xml.NewDecoder(bufio.NewReaderSize(r, 1<<16))
+	for {
+		offset := d.InputOffset()
+		tok, err := d.Token()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		se, ok := tok.(xml.StartElement)
+		if !ok || se.Name.Local != "entry" {
+			continue
+		}
+		e := &uniprotXMLEntry{}
+		if err = d.DecodeElement(e, &se); err != nil {
+			return err
+		}
+		if err = fn(offset, e.response()); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,120 @@
+//
+//    Lollipops diagram generation framework for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package drawing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joiningdata/lollipops/data"
+	"gopkg.in/yaml.v3"
+)
+
+// LoadConfig reads a settings file and applies any values it contains to s.
+// The format is chosen by file extension (.json, .yaml/.yml or .toml), and
+// keys are the Settings field names (matched case-insensitively), e.g.:
+//
+//	LollipopRadius: 5
+//	DomainHeight: 30
+//	DomainColors:
+//	  PF00870: "#2DCF00"
+func (s *Settings) LoadConfig(filename string) error {
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	m := make(map[string]interface{})
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		err = json.Unmarshal(raw, &m)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(raw, &m)
+	case ".toml":
+		err = toml.Unmarshal(raw, &m)
+	default:
+		return fmt.Errorf("unknown config file format '%s' (use .json, .yaml or .toml)", filepath.Ext(filename))
+	}
+	if err != nil {
+		return fmt.Errorf("unable to parse config file '%s': %s", filename, err)
+	}
+	return s.ApplyConfig(m)
+}
+
+// ApplyConfig sets the Settings fields named by the keys in m (matched
+// case-insensitively) to the associated values. Fields not present in m
+// are left unchanged, and unknown keys are reported as an error.
+func (s *Settings) ApplyConfig(m map[string]interface{}) error {
+	// round-trip through JSON so that every format shares the same
+	// field matching and type conversion rules
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(s); err != nil {
+		return fmt.Errorf("invalid settings: %s", err)
+	}
+	return nil
+}
+
+// Clone returns a copy of s that can be modified (or drawn with, which
+// updates the computed sizes) without affecting s.
+func (s *Settings) Clone() *Settings {
+	c := *s
+	c.DomainPalette = append([]string(nil), s.DomainPalette...)
+	if s.DomainColors != nil {
+		c.DomainColors = make(map[string]string, len(s.DomainColors))
+		for k, v := range s.DomainColors {
+			c.DomainColors[k] = v
+		}
+	}
+	c.Hotspots = append(c.Hotspots[:0:0], s.Hotspots...)
+	if s.Samples != nil {
+		c.Samples = make(map[string][]string, len(s.Samples))
+		for k, v := range s.Samples {
+			c.Samples[k] = append([]string(nil), v...)
+		}
+	}
+	c.legendInfo = nil
+	return &c
+}
+
+// domainColor returns the color to use for region r, taking the DomainPalette
+// and any matching DomainColors override (by accession, short name or
+// description) into account.
+func (s *Settings) domainColor(r data.GraphicFeature) string {
+	for _, key := range []string{r.Metadata.Identifier, r.Text, r.Metadata.Description} {
+		if key == "" {
+			continue
+		}
+		if c, ok := s.DomainColors[key]; ok {
+			return c
+		}
+	}
+	if len(s.DomainPalette) > 0 {
+		return data.DomainColor(r.Metadata.Identifier, s.DomainPalette)
+	}
+	return r.Color
+}
@@ -0,0 +1,93 @@
+//
+//    Lollipops diagram generation framework for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package drawing
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/joiningdata/lollipops/data"
+)
+
+func testRegion(acc string, start, end int) data.GraphicFeature {
+	return data.GraphicFeature{
+		Text:     acc,
+		Start:    json.Number(fmt.Sprint(start)),
+		End:      json.Number(fmt.Sprint(end)),
+		Metadata: data.GraphicMetadata{Identifier: acc, Description: acc},
+	}
+}
+
+func layoutColors(t *testing.T, g *data.GraphicResponse) map[string]string {
+	t.Helper()
+	s := DefaultSettings.Clone()
+	s.DomainPalette = data.DomainPalette
+	l, err := s.Layout(nil, g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	colors := make(map[string]string)
+	for _, d := range l.Domains {
+		colors[d.Accession] = d.Color
+	}
+	return colors
+}
+
+// TestDomainColorsStable checks that adding a domain to a diagram, even one
+// that hashes to the same color as an existing domain, leaves the colors of
+// the other domains unchanged.
+func TestDomainColorsStable(t *testing.T) {
+	if err := LoadDefaultFont(); err != nil {
+		t.Fatal(err)
+	}
+	g := &data.GraphicResponse{
+		Length: "400",
+		Regions: []data.GraphicFeature{
+			testRegion("PF08563", 5, 30),
+			testRegion("PF00870", 100, 290),
+			testRegion("PF07710", 320, 355),
+		},
+	}
+	before := layoutColors(t, g)
+
+	// find another accession with the same hash slot as PF00870
+	collide := ""
+	for i := 1; collide == "" && i < 1000; i++ {
+		acc := fmt.Sprintf("PF%05d", i)
+		if acc != "PF00870" && data.DomainColor(acc, data.DomainPalette) == before["PF00870"] {
+			collide = acc
+		}
+	}
+	if collide == "" {
+		t.Fatal("no accession collides with PF00870")
+	}
+	for _, added := range []string{collide, "PF00001"} {
+		g2 := *g
+		g2.Regions = append([]data.GraphicFeature{testRegion(added, 40, 90)}, g.Regions...)
+		after := layoutColors(t, &g2)
+		for acc, c := range before {
+			if after[acc] != c {
+				t.Errorf("adding %s changed the color of %s from %s to %s", added, acc, c, after[acc])
+			}
+		}
+		if after[added] != data.DomainColor(added, data.DomainPalette) {
+			t.Errorf("%s was colored %s, expected its own hash color", added, after[added])
+		}
+	}
+}
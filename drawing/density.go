@@ -0,0 +1,133 @@
+//
+//    Lollipops diagram generation framework for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package drawing
+
+import (
+	"math"
+
+	"github.com/joiningdata/lollipops/analysis"
+)
+
+// denseWindowAlpha is the (Bonferroni-corrected) significance level for
+// shading a window as having more mutations than expected.
+const denseWindowAlpha = 0.05
+
+// computeDensity fills in the kernel-smoothed mutation density along the
+// protein, and the windows that contain significantly more mutations than
+// expected if the same number were spread uniformly along the protein.
+func (d *diagram) computeDensity(pops TickSlice, aaLen int) {
+	if aaLen <= 0 || len(pops) == 0 {
+		return
+	}
+	bw := d.DensityBandwidth
+	if bw <= 0 {
+		bw = math.Max(3, float64(aaLen)/100.0)
+	}
+
+	// Gaussian kernel density, weighted by the count at each position
+	d.density = make([]float64, aaLen+1)
+	total := 0
+	for _, p := range pops {
+		total += p.Cnt
+	}
+	for i := range d.density {
+		sum := 0.0
+		for _, p := range pops {
+			z := float64(i-p.Pos) / bw
+			if z > -4 && z < 4 {
+				sum += float64(p.Cnt) * math.Exp(-0.5*z*z)
+			}
+		}
+		d.density[i] = sum
+	}
+
+	// scan fixed-width windows and test each count against a Poisson
+	// background, correcting for the number of non-overlapping windows
+	width := int(math.Ceil(2 * bw))
+	if width > aaLen {
+		width = aaLen
+	}
+	counts := make([]int, aaLen+2)
+	for _, p := range pops {
+		if p.Pos >= 0 && p.Pos <= aaLen {
+			counts[p.Pos] += p.Cnt
+		}
+	}
+	lambda := float64(total) * float64(width) / float64(aaLen)
+	ntests := float64(aaLen) / float64(width)
+	if ntests < 1 {
+		ntests = 1
+	}
+
+	var cur *[2]int
+	for start := 1; start+width-1 <= aaLen; start++ {
+		k := 0
+		for i := start; i < start+width; i++ {
+			k += counts[i]
+		}
+		if k < 2 || poissonUpperTail(k, lambda)*ntests >= denseWindowAlpha {
+			continue
+		}
+		end := start + width - 1
+		if cur != nil && start <= cur[1]+1 {
+			cur[1] = end
+			continue
+		}
+		d.denseWindows = append(d.denseWindows, [2]int{start, end})
+		cur = &d.denseWindows[len(d.denseWindows)-1]
+	}
+}
+
+// poissonUpperTail returns P(X >= k) for X ~ Poisson(lambda).
+func poissonUpperTail(k int, lambda float64) float64 {
+	if k <= 0 {
+		return 1
+	}
+	// 1 - P(X <= k-1), summing the terms in log space
+	cdf := 0.0
+	for i := 0; i < k; i++ {
+		lg, _ := math.Lgamma(float64(i + 1))
+		cdf += math.Exp(float64(i)*math.Log(lambda) - lambda - lg)
+	}
+	if cdf > 1 {
+		return 0
+	}
+	return 1 - cdf
+}
+
+// densityPeak returns the maximum of the density track.
+func (d *diagram) densityPeak() float64 {
+	peak := 0.0
+	for _, v := range d.density {
+		if v > peak {
+			peak = v
+		}
+	}
+	return peak
+}
+
+// positionHotspot returns the significant hotspot at amino acid position pos,
+// or nil if the position is not a hotspot.
+func (d *diagram) positionHotspot(pos int) *analysis.Hotspot {
+	for i, h := range d.Hotspots {
+		if h.Type == "position" && h.Start == pos {
+			return &d.Hotspots[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,43 @@
+//
+//    Lollipops diagram generation framework for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package drawing
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPoissonUpperTail(t *testing.T) {
+	for _, c := range []struct {
+		k      int
+		lambda float64
+		want   float64
+	}{
+		// computed with 60-digit decimal arithmetic
+		{0, 2, 1},
+		{1, 2, 0.8646647167633873},
+		{3, 2, 0.32332358381693654},
+		{10, 3, 0.0011024881301154798},
+		{5, 0.5, 0.00017211562995584078},
+	} {
+		got := poissonUpperTail(c.k, c.lambda)
+		if math.Abs(got-c.want) > 1e-9*c.want {
+			t.Errorf("poissonUpperTail(%d, %g) = %g, expected %g", c.k, c.lambda, got, c.want)
+		}
+	}
+}
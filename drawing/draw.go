@@ -18,8 +18,8 @@
 package drawing
 
 import (
+	"errors"
 	"fmt"
-	"log"
 	"sort"
 	"strings"
 	"unicode"
@@ -38,15 +38,113 @@ type diagram struct {
 
 	ticks        TickSlice
 	domainLabels []string
+	domainRows   []int
 	startY       float64
+
+	// belowHeight is the height of everything drawn below the backbone's
+	// domain row (e.g. stacked domain rows and annotation tracks).
+	belowHeight float64
+	// density is the smoothed mutation density at each amino acid position,
+	// and denseWindows are the [start,end] ranges with significantly more
+	// mutations than expected.
+	density       []float64
+	denseWindows  [][2]int
+	densityHeight float64
+
+	// title is the text of the title line, if shown.
+	title string
+
+	// trackTop is the offset of the first annotation track from the top
+	// of the backbone's domain row.
+	trackTop float64
 }
 
-func (s *Settings) prepare(changelist []string, g *data.GraphicResponse) *diagram {
+// trackY returns the top of the features in annotation track ti, given the
+// top of the backbone's domain row.
+func (d *diagram) trackY(rowTop float64, ti int) float64 {
+	return rowTop + d.trackTop + float64(ti)*(d.TrackHeight+d.TrackPadding) + d.TrackPadding
+}
+
+// titleText returns the Title setting, or a title built from the protein
+// metadata, e.g. "TP53: Cellular tumor antigen p53 (Homo sapiens, UniProt P04637 v287)".
+func (s *Settings) titleText(m data.GraphicMetadata) string {
+	if s.Title != "" {
+		return s.Title
+	}
+	title := m.GeneName
+	if m.ProteinName != "" {
+		if title != "" {
+			title += ": "
+		}
+		title += m.ProteinName
+	}
+	var details []string
+	if m.Organism != "" {
+		details = append(details, m.Organism)
+	}
+	if m.Accession != "" {
+		acc := "UniProt " + m.Accession
+		if m.EntryVersion != 0 {
+			acc += fmt.Sprintf(" v%d", m.EntryVersion)
+		}
+		details = append(details, acc)
+	}
+	if len(details) > 0 {
+		if title != "" {
+			title += " "
+		}
+		title += "(" + strings.Join(details, ", ") + ")"
+	}
+	if title == "" {
+		// fall back to the older metadata fields
+		title = strings.TrimSpace(m.Identifier + " " + m.Description)
+	}
+	return title
+}
+
+// titleHeight is the space used by the title line.
+func (s *Settings) titleHeight() float64 {
+	if s.dpi != 0 {
+		return 20 * s.dpi / 72.0
+	}
+	return 20
+}
+
+// featureSpan returns the x position and width of a track feature, widening
+// short features (e.g. single residues) so that they remain visible.
+func (d *diagram) featureSpan(f data.GraphicFeature, scale float64) (float64, float64) {
+	start, _ := f.Start.Float64()
+	end, _ := f.End.Float64()
+	x := d.Padding + start*scale
+	w := (end - start) * scale
+	minW := 2.0
+	if d.dpi != 0 {
+		minW *= d.dpi / 72.0
+	}
+	if w < minW {
+		x -= (minW - w) / 2
+		w = minW
+	}
+	return x, w
+}
+
+func (s *Settings) prepare(changelist []string, g *data.GraphicResponse) (*diagram, error) {
 	// don't alter the source changelist
 	newchanges := make([]string, len(changelist))
 	copy(newchanges, changelist)
 	changelist = newchanges
 
+	if len(s.DomainColors) > 0 || len(s.DomainPalette) > 0 {
+		// don't alter the source regions either
+		ng := *g
+		ng.Regions = make([]data.GraphicFeature, len(g.Regions))
+		for i, r := range g.Regions {
+			r.Color = s.domainColor(r)
+			ng.Regions[i] = r
+		}
+		g = &ng
+	}
+
 	d := &diagram{
 		Settings:   s,
 		g:          g,
@@ -66,6 +164,13 @@ func (s *Settings) prepare(changelist []string, g *data.GraphicResponse) *diagra
 	pops := TickSlice{}
 	var col string
 	s.GraphicHeight = s.DomainHeight + s.Padding*2
+	if s.ShowTitle {
+		d.title = s.titleText(g.Metadata)
+		if d.title != "" {
+			startY += s.titleHeight()
+			s.GraphicHeight += s.titleHeight()
+		}
+	}
 	if len(changelist) > 0 {
 		popMatch := make(map[string]int)
 		// parse changelist and check if lollipops need staggered
@@ -76,6 +181,9 @@ func (s *Settings) prepare(changelist []string, g *data.GraphicResponse) *diagra
 			cnt := 1
 			cpos := stripChangePos.FindStringSubmatch(chg)
 			spos := 0
+			class := changeClass(chg, cpos)
+			// the marker colors predate the classes and are kept as they were,
+			// e.g. R213* is still drawn in the synonymous color
 			col = s.SynonymousColor
 			if len(cpos) == 4 && (cpos[3] != "" && cpos[3] != "=" && cpos[3] != cpos[1]) {
 				col = s.MutationColor
@@ -85,6 +193,7 @@ func (s *Settings) prepare(changelist []string, g *data.GraphicResponse) *diagra
 				fmt.Sscanf(parts[1], "%d", &cnt)
 				chg = parts[0]
 			}
+			samples := s.Samples[chg]
 			if strings.Contains(chg, "#") {
 				parts := strings.SplitN(chg, "#", 2)
 				col = "#" + parts[1]
@@ -95,9 +204,11 @@ func (s *Settings) prepare(changelist []string, g *data.GraphicResponse) *diagra
 			col = strings.ToLower(col)
 			if idx, f := popMatch[chg+col]; f {
 				pops[idx].Cnt += cnt
+				pops[idx].samples = append(pops[idx].samples, samples...)
 			} else {
 				popMatch[chg+col] = len(pops)
-				pops = append(pops, Tick{Pos: spos, Pri: -i, Cnt: cnt, Col: col})
+				pops = append(pops, Tick{Pos: spos, Pri: -i, Cnt: cnt, Col: col, class: class,
+					samples: append([]string(nil), samples...)})
 			}
 		}
 		sort.Sort(pops)
@@ -116,6 +227,12 @@ func (s *Settings) prepare(changelist []string, g *data.GraphicResponse) *diagra
 		}
 		s.GraphicHeight += maxStaggered
 		startY += maxStaggered - (s.LollipopRadius + s.LollipopHeight)
+
+		if s.ShowDensity {
+			d.computeDensity(pops, int(aaLen))
+			d.densityHeight = s.DensityHeight
+			s.GraphicHeight += d.densityHeight
+		}
 	}
 	if !s.HideAxis {
 		s.GraphicHeight += s.AxisPadding + s.AxisHeight
@@ -125,6 +242,24 @@ func (s *Settings) prepare(changelist []string, g *data.GraphicResponse) *diagra
 		s.legendInfo = make(map[string]string)
 	}
 
+	var nrows int
+	d.domainRows, nrows = s.stackRegions(g.Regions)
+	if nrows > 1 {
+		d.belowHeight += float64(nrows-1) * (s.DomainHeight + s.DomainRowPadding)
+	}
+	if len(g.Tracks) > 0 {
+		d.trackTop = s.DomainHeight + d.belowHeight
+		d.belowHeight += float64(len(g.Tracks)) * (s.TrackHeight + s.TrackPadding)
+		for _, t := range g.Tracks {
+			for _, f := range t.Features {
+				if s.legendInfo != nil && f.Color != "" {
+					s.legendInfo[f.Type] = f.Color
+				}
+			}
+		}
+	}
+	s.GraphicHeight += d.belowHeight
+
 	d.startY = startY
 	d.ticks = append(d.ticks,
 		Tick{Pos: 0, Pri: 0},           // start isn't very important (0 is implied)
@@ -148,10 +283,13 @@ func (s *Settings) prepare(changelist []string, g *data.GraphicResponse) *diagra
 			d.ticks = append(d.ticks, Tick{
 				Pos: pop.Pos,
 				Pri: 10,
+				Cnt: pop.Cnt,
 				Col: pop.Col,
 
 				isLollipop: true,
 				label:      changelist[-pop.Pri],
+				class:      pop.class,
+				samples:    pop.samples,
 				x:          spos,
 				y:          mytop,
 				r:          pop.Radius(s),
@@ -175,7 +313,7 @@ func (s *Settings) prepare(changelist []string, g *data.GraphicResponse) *diagra
 				d.ticks = append(d.ticks, Tick{Pos: int(tend), Pri: 1})
 			}
 			if s.legendInfo != nil {
-				s.legendInfo[r.Type] = BlendColorStrings(r.Color, "#FFFFFF")
+				s.legendInfo[r.Type] = BlendColorStrings(r.Color, s.MotifBlendColor)
 			}
 		}
 	}
@@ -248,16 +386,18 @@ func (s *Settings) prepare(changelist []string, g *data.GraphicResponse) *diagra
 	}
 
 	if s.legendInfo != nil {
-
-		fface := truetype.NewFace(theFont, &truetype.Options{
+		if theFont == nil {
+			return nil, errors.New("no font loaded - cannot size the legend")
+		}
+		fface := newFace(&truetype.Options{
 			Size:    float64(12.0),
-			DPI:     float64(DefaultSettings.dpi),
+			DPI:     float64(s.dpi),
 			Hinting: font.HintingFull,
 		})
 		// get font height in px
 		bounds, _, ok := fface.GlyphBounds('M')
 		if !ok {
-			log.Fatalf("unable to determine font bounds!")
+			return nil, errors.New("unable to determine font bounds")
 		}
 		// add 2px line spacing
 		fontH := bounds.Max.Sub(bounds.Min).Y + fixed.I(2)
@@ -273,5 +413,47 @@ func (s *Settings) prepare(changelist []string, g *data.GraphicResponse) *diagra
 	}
 
 	sort.Sort(d.ticks)
-	return d
+	if s.ShowLabels {
+		d.placeLabels()
+	}
+	return d, nil
+}
+
+// stackRegions assigns each region to a row so that no two regions in the
+// same row overlap. Rows are packed greedily in order of starting position,
+// and the number of rows used is returned. Unless DomainLayout is "stacked",
+// every region is placed in row 0.
+func (s *Settings) stackRegions(regions []data.GraphicFeature) ([]int, int) {
+	rows := make([]int, len(regions))
+	if s.DomainLayout != "stacked" || len(regions) == 0 {
+		return rows, 1
+	}
+
+	order := make([]int, len(regions))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, _ := regions[order[i]].Start.Int64()
+		b, _ := regions[order[j]].Start.Int64()
+		return a < b
+	})
+
+	// rowEnds tracks the last amino acid position occupied in each row
+	var rowEnds []int64
+	for _, ri := range order {
+		start, _ := regions[ri].Start.Int64()
+		end, _ := regions[ri].End.Int64()
+		row := 0
+		for row < len(rowEnds) && rowEnds[row] >= start {
+			row++
+		}
+		if row == len(rowEnds) {
+			rowEnds = append(rowEnds, end)
+		} else {
+			rowEnds[row] = end
+		}
+		rows[ri] = row
+	}
+	return rows, len(rowEnds)
 }
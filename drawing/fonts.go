@@ -18,97 +18,191 @@
 package drawing
 
 import (
+	"encoding/base64"
 	"fmt"
-	"io"
+	"image"
 	"io/ioutil"
-	"net/http"
-	"os"
+	"strings"
 
 	"github.com/golang/freetype/truetype"
 	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/math/fixed"
 )
 
 var (
+	// FontName is the CSS font-family list used in SVG output, before the
+	// generic sans-serif fallback.
 	FontName string
 	theFont  *truetype.Font
+
+	// fallbackFonts are used (in order) for any glyphs missing from theFont.
+	fallbackFonts []loadedFont
+	// theFontData is the TrueType file theFont was parsed from.
+	theFontData []byte
+	theFontName string
 )
 
-var defaultFontURL = "https://github.com/googlefonts/opensans/raw/main/fonts/ttf/OpenSans-Regular.ttf"
+type loadedFont struct {
+	name string
+	font *truetype.Font
+	data []byte
+}
+
+// ArialPaths are the most common locations of Arial, searched in order by
+// LoadDefaultFont.
+var ArialPaths = []string{
+	// OS X path
+	"/Library/Fonts/Arial.ttf",
+
+	// Windows paths
+	"C:\\WINDOWS\\Fonts\\arial.ttf",
+	"C:\\WINNT\\Fonts\\arial.ttf",
+
+	// Ubuntu with multiverse msttcorefonts package
+	"/usr/share/fonts/truetype/msttcorefonts/arial.ttf",
+}
 
 // we try to have sane defaults wrt font usage
 //
 // 1) auto-load Arial if found as the default font.
 // 2) allow users to set a different font if desired
+// 3) otherwise use the bundled Go font (BSD licensed, see
+//    https://go.dev/blog/go-fonts) so no network access is needed.
 //
 
 func LoadDefaultFont() error {
-	// try to find Arial in the most common locations
-	commonPaths := []string{
-		// OS X path
-		"/Library/Fonts/Arial.ttf",
-
-		// Windows paths
-		"C:\\WINDOWS\\Fonts\\arial.ttf",
-		"C:\\WINNT\\Fonts\\arial.ttf",
-
-		// Ubuntu with multiverse msttcorefonts package
-		"/usr/share/fonts/truetype/msttcorefonts/arial.ttf",
-	}
-	for _, path := range commonPaths {
+	for _, path := range ArialPaths {
 		err := LoadFont("Arial", path)
 		if err == nil {
 			return nil
 		}
 	}
-	err := LoadFont("OpenSans", "OpenSans-Regular.ttf")
-	if err == nil {
-		return nil
-	}
 
-	resp, err := http.Get(defaultFontURL)
-	if err == nil {
-		fmt.Fprintln(os.Stderr, "Downloading Font: OpenSans-Regular.ttf (Apache Licensed)")
-		fmt.Fprintln(os.Stderr, "Learn more about usage at https://github.com/googlefonts/opensans")
-		fmt.Fprint(os.Stderr, "Or provide a different truetype font with -f fontname.ttf\n\n")
-
-		f, err := os.Create("OpenSans-Regular.ttf")
-		if err == nil {
-			n, err := io.Copy(f, resp.Body)
-			if n == 0 || err != nil {
-				return fmt.Errorf("failed to download a font to use")
-			}
-		}
-		f.Close()
-		resp.Body.Close()
-		err = LoadFont("OpenSans", "OpenSans-Regular.ttf")
-		if err == nil {
-			return nil
-		}
+	// "Go" is the font's family name, so viewers with it installed use it
+	if err := LoadFontData("Go", goregular.TTF); err != nil {
+		return fmt.Errorf("Arial was not found (searched %s) and the bundled font failed to load: %s",
+			strings.Join(ArialPaths, ", "), err)
 	}
-
-	return fmt.Errorf("unable to find Arial.ttf")
+	return nil
 }
 
+// LoadFont loads the TrueType font file at path to use for drawing, replacing
+// any fonts previously loaded.
 func LoadFont(name, path string) error {
 	fontBytes, err := ioutil.ReadFile(path)
 	if err != nil {
 		return err
 	}
-	theFont, err = truetype.Parse(fontBytes)
+	return LoadFontData(name, fontBytes)
+}
+
+// LoadFontData loads a TrueType font from memory to use for drawing, replacing
+// any fonts previously loaded.
+func LoadFontData(name string, fontBytes []byte) error {
+	f, err := truetype.Parse(fontBytes)
 	if err != nil {
 		return err
 	}
+	theFont = f
+	theFontData = fontBytes
+	theFontName = name
+	fallbackFonts = nil
 	FontName = name
 	return nil
 }
 
+// AddFallbackFont loads the TrueType font file at path to use for any glyphs
+// that are missing from the fonts already loaded.
+func AddFallbackFont(name, path string) error {
+	if theFont == nil {
+		return LoadFont(name, path)
+	}
+	fontBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	f, err := truetype.Parse(fontBytes)
+	if err != nil {
+		return err
+	}
+	fallbackFonts = append(fallbackFonts, loadedFont{name, f, fontBytes})
+	FontName += ", " + name
+	return nil
+}
+
+// newFace returns a font face for the loaded fonts which takes each glyph
+// from the first font containing it.
+func newFace(opts *truetype.Options) font.Face {
+	primary := truetype.NewFace(theFont, opts)
+	if len(fallbackFonts) == 0 {
+		return primary
+	}
+	ff := &fallbackFace{
+		fonts: []*truetype.Font{theFont},
+		faces: []font.Face{primary},
+	}
+	for _, fb := range fallbackFonts {
+		ff.fonts = append(ff.fonts, fb.font)
+		ff.faces = append(ff.faces, truetype.NewFace(fb.font, opts))
+	}
+	return ff
+}
+
+// fallbackFace implements font.Face using the first of several fonts
+// that has a glyph for each rune.
+type fallbackFace struct {
+	fonts []*truetype.Font
+	faces []font.Face
+}
+
+func (f *fallbackFace) pick(r rune) font.Face {
+	for i, tf := range f.fonts {
+		if tf.Index(r) != 0 {
+			return f.faces[i]
+		}
+	}
+	return f.faces[0]
+}
+
+func (f *fallbackFace) Close() error {
+	for _, face := range f.faces {
+		face.Close()
+	}
+	return nil
+}
+
+func (f *fallbackFace) Glyph(dot fixed.Point26_6, r rune) (image.Rectangle, image.Image, image.Point, fixed.Int26_6, bool) {
+	return f.pick(r).Glyph(dot, r)
+}
+
+func (f *fallbackFace) GlyphBounds(r rune) (fixed.Rectangle26_6, fixed.Int26_6, bool) {
+	return f.pick(r).GlyphBounds(r)
+}
+
+func (f *fallbackFace) GlyphAdvance(r rune) (fixed.Int26_6, bool) {
+	return f.pick(r).GlyphAdvance(r)
+}
+
+func (f *fallbackFace) Kern(r0, r1 rune) fixed.Int26_6 {
+	// only kern pairs of glyphs that come from the same font
+	if face := f.pick(r0); face == f.pick(r1) {
+		return face.Kern(r0, r1)
+	}
+	return 0
+}
+
+func (f *fallbackFace) Metrics() font.Metrics {
+	return f.faces[0].Metrics()
+}
+
 // MeasureFont returns the pixel width of the string s at font size sz.
 // It tries to use system Arial font if possible, but falls back to a
 // conservative ballpark estimate otherwise.
 func (x *Settings) MeasureFont(s string, sz int) int {
 	// use actual TTF font metrics if available
 	if theFont != nil {
-		myFace := truetype.NewFace(theFont, &truetype.Options{
+		myFace := newFace(&truetype.Options{
 			Size: float64(sz),
 			DPI:  float64(x.dpi),
 		})
@@ -121,3 +215,26 @@ func (x *Settings) MeasureFont(s string, sz int) int {
 
 	return len(s) * (sz - 2)
 }
+
+// fontFaceCSS returns CSS @font-face rules embedding the loaded fonts as
+// base64 data. If used is non-empty, the fonts are reduced to the glyphs
+// needed to draw those runes.
+func fontFaceCSS(used map[rune]bool) string {
+	if theFont == nil || FontName == "" {
+		return ""
+	}
+	fonts := append([]loadedFont{{theFontName, theFont, theFontData}}, fallbackFonts...)
+	rules := make([]string, len(fonts))
+	for i, lf := range fonts {
+		ttf := lf.data
+		if len(used) > 0 {
+			sub, err := subsetFont(lf.font, lf.data, used)
+			if err == nil {
+				ttf = sub
+			}
+		}
+		rules[i] = fmt.Sprintf(`@font-face { font-family:%s; src:url("data:font/ttf;base64,%s") format("truetype"); }`,
+			lf.name, base64.StdEncoding.EncodeToString(ttf))
+	}
+	return strings.Join(rules, "\n")
+}
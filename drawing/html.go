@@ -0,0 +1,256 @@
+//
+//    Lollipops diagram generation framework for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package drawing
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"strings"
+
+	"github.com/joiningdata/lollipops/data"
+)
+
+// DrawHTML writes a self-contained interactive HTML report to w, using the
+// DefaultSettings.
+func DrawHTML(w io.Writer, changelist []string, g *data.GraphicResponse) error {
+	return DefaultSettings.DrawHTML(w, changelist, g)
+}
+
+// DrawHTML writes a self-contained interactive HTML report to w. The report
+// contains the SVG diagram (with tooltips, domain links and zoom/pan) and a
+// sortable table of the variants in changelist.
+func (s *Settings) DrawHTML(w io.Writer, changelist []string, g *data.GraphicResponse) error {
+	d, err := s.prepare(changelist, g)
+	if err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	if err := d.svg(buf); err != nil {
+		return err
+	}
+	svg := buf.String()
+	// drop the XML declaration, it is not allowed inside HTML
+	if i := strings.Index(svg, "?>"); strings.HasPrefix(svg, "<?xml") && i != -1 {
+		svg = svg[i+2:]
+	}
+
+	report := htmlReport{
+		Title:    s.titleText(g.Metadata),
+		SVG:      template.HTML(svg),
+		Variants: d.variantRows(),
+	}
+	for _, v := range report.Variants {
+		if v.Samples != "" {
+			report.HasSamples = true
+		}
+	}
+	if report.Title == "" {
+		report.Title = "Lollipops report"
+	}
+	return htmlReportTemplate.Execute(w, report)
+}
+
+type htmlReport struct {
+	Title    string
+	SVG      template.HTML
+	Variants []variantRow
+	// HasSamples is set if any variant lists its samples.
+	HasSamples bool
+}
+
+// variantRow describes a single lollipop in the report's variant table.
+type variantRow struct {
+	Label  string
+	Pos    int
+	Count  int
+	Color  string
+	Domain string
+
+	// Samples lists the IDs of the samples with the variant, if known.
+	Samples string
+}
+
+// variantRows lists each lollipop in the diagram along with the names of the
+// domains that it falls within.
+func (d *diagram) variantRows() []variantRow {
+	var rows []variantRow
+	for _, t := range d.ticks {
+		if !t.isLollipop {
+			continue
+		}
+		rows = append(rows, variantRow{
+			Label:   t.label,
+			Pos:     t.Pos,
+			Count:   t.Cnt,
+			Color:   t.Col,
+			Domain:  strings.Join(d.regionsAt(t.Pos), ", "),
+			Samples: strings.Join(t.samples, ", "),
+		})
+	}
+	return rows
+}
+
+// regionsAt returns the names of the domains containing amino acid pos.
+func (d *diagram) regionsAt(pos int) []string {
+	var names []string
+	for _, r := range d.g.Regions {
+		start, _ := r.Start.Int64()
+		end, _ := r.End.Int64()
+		if int64(pos) < start || int64(pos) > end {
+			continue
+		}
+		name := r.Text
+		if name == "" {
+			name = r.Metadata.Description
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: Arial, Helvetica, sans-serif; margin: 20px; color: #222; }
+#figure { border: 1px solid #ddd; overflow: hidden; cursor: grab; position: relative; }
+#figure svg { display: block; width: 100%; height: auto; }
+#figure.panning { cursor: grabbing; }
+#tooltip { position: fixed; pointer-events: none; background: rgba(0,0,0,0.8); color: #fff;
+  padding: 4px 8px; border-radius: 3px; font-size: 12px; display: none; white-space: pre; }
+.controls { margin: 6px 0; font-size: 12px; color: #666; }
+table { border-collapse: collapse; margin-top: 16px; font-size: 13px; }
+th, td { border: 1px solid #ddd; padding: 4px 10px; text-align: left; }
+th { background: #f4f4f4; cursor: pointer; user-select: none; }
+th.asc::after { content: " \25B2"; }
+th.desc::after { content: " \25BC"; }
+td.num { text-align: right; }
+.swatch { display: inline-block; width: 10px; height: 10px; border-radius: 5px; margin-right: 4px; }
+</style>
+</head>
+<body>
+<h2>{{.Title}}</h2>
+<div class="controls">Scroll to zoom, drag to pan, double-click to reset.</div>
+<div id="figure">{{.SVG}}</div>
+<div id="tooltip"></div>
+{{if .Variants}}
+<table id="variants">
+<thead><tr>
+<th data-type="str">Variant</th><th data-type="num">Position</th><th data-type="num">Count</th><th data-type="str">Domain</th>{{if .HasSamples}}<th data-type="str">Samples</th>{{end}}
+</tr></thead>
+<tbody>
+{{range .Variants}}<tr><td><span class="swatch" style="background:{{.Color}}"></span>{{.Label}}</td><td class="num">{{.Pos}}</td><td class="num">{{.Count}}</td><td>{{.Domain}}</td>{{if $.HasSamples}}<td>{{.Samples}}</td>{{end}}</tr>
+{{end}}</tbody>
+</table>
+{{end}}
+<script>
+(function() {
+  var fig = document.getElementById("figure");
+  var svg = fig.querySelector("svg");
+  var tip = document.getElementById("tooltip");
+
+  // tooltips from the data-* attributes and titles of diagram elements
+  // the custom tooltip replaces the browser's native title tooltip
+  svg.querySelectorAll("a").forEach(function(a) {
+    var t = a.getAttributeNS("http://www.w3.org/1999/xlink", "title");
+    if (t) {
+      a.setAttribute("data-title", t);
+      a.removeAttributeNS("http://www.w3.org/1999/xlink", "title");
+    }
+  });
+  svg.addEventListener("mousemove", function(e) {
+    var el = e.target.closest("[data-label],[data-title]");
+    if (!el) { tip.style.display = "none"; return; }
+    var text;
+    if (el.hasAttribute("data-label")) {
+      text = el.getAttribute("data-label") + "\nCount: " + el.getAttribute("data-count");
+      if (el.getAttribute("data-domain")) text += "\nDomain: " + el.getAttribute("data-domain");
+      if (el.getAttribute("data-samples")) {
+        // long sample lists are cut short, the table has them all
+        var samples = el.getAttribute("data-samples").split(", ");
+        text += "\nSamples: " + samples.slice(0, 10).join(", ");
+        if (samples.length > 10) text += " (+" + (samples.length - 10) + " more)";
+      }
+    } else {
+      text = el.getAttribute("data-title");
+    }
+    if (!text) { tip.style.display = "none"; return; }
+    tip.textContent = text;
+    tip.style.left = (e.clientX + 12) + "px";
+    tip.style.top = (e.clientY + 12) + "px";
+    tip.style.display = "block";
+  });
+  svg.addEventListener("mouseleave", function() { tip.style.display = "none"; });
+
+  // zoom and pan by adjusting the viewBox
+  var vb0 = svg.viewBox.baseVal;
+  var orig = [vb0.x, vb0.y, vb0.width, vb0.height];
+  var vb = orig.slice();
+  function apply() { svg.setAttribute("viewBox", vb.join(" ")); }
+  function toSVG(e) {
+    var r = svg.getBoundingClientRect();
+    return [vb[0] + (e.clientX - r.left) / r.width * vb[2], vb[1] + (e.clientY - r.top) / r.height * vb[3]];
+  }
+  fig.addEventListener("wheel", function(e) {
+    e.preventDefault();
+    var p = toSVG(e);
+    var k = e.deltaY < 0 ? 0.8 : 1.25;
+    var w = Math.min(orig[2], vb[2] * k), h = Math.min(orig[3], vb[3] * k);
+    vb = [p[0] - (p[0] - vb[0]) * w / vb[2], p[1] - (p[1] - vb[1]) * h / vb[3], w, h];
+    apply();
+  }, {passive: false});
+  var drag = null;
+  fig.addEventListener("mousedown", function(e) { drag = [e.clientX, e.clientY, vb[0], vb[1]]; fig.classList.add("panning"); });
+  window.addEventListener("mouseup", function() { drag = null; fig.classList.remove("panning"); });
+  window.addEventListener("mousemove", function(e) {
+    if (!drag) return;
+    var r = svg.getBoundingClientRect();
+    vb[0] = drag[2] - (e.clientX - drag[0]) / r.width * vb[2];
+    vb[1] = drag[3] - (e.clientY - drag[1]) / r.height * vb[3];
+    apply();
+  });
+  fig.addEventListener("dblclick", function() { vb = orig.slice(); apply(); });
+
+  // sortable variant table
+  var table = document.getElementById("variants");
+  if (!table) return;
+  table.querySelectorAll("th").forEach(function(th, col) {
+    th.addEventListener("click", function() {
+      var asc = !th.classList.contains("asc");
+      table.querySelectorAll("th").forEach(function(h) { h.classList.remove("asc", "desc"); });
+      th.classList.add(asc ? "asc" : "desc");
+      var num = th.getAttribute("data-type") === "num";
+      var tbody = table.tBodies[0];
+      var rows = Array.prototype.slice.call(tbody.rows);
+      rows.sort(function(a, b) {
+        var x = a.cells[col].textContent, y = b.cells[col].textContent;
+        var c = num ? parseFloat(x) - parseFloat(y) : x.localeCompare(y);
+        return asc ? c : -c;
+      });
+      rows.forEach(function(r) { tbody.appendChild(r); });
+    });
+  });
+})();
+</script>
+</body>
+</html>
+`))
@@ -0,0 +1,119 @@
+//
+//    Lollipops diagram generation framework for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package drawing
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// maxLabelLifts is the number of positions above the lollipop that are tried
+// before a label is dropped because it would overlap its neighbors.
+const maxLabelLifts = 4
+
+// labelBox is a label's extent in a coordinate frame rotated to match the
+// label text, so that overlapping labels can be detected with simple ranges.
+type labelBox struct {
+	a0, a1 float64 // along the text baseline
+	b0, b1 float64 // perpendicular to the baseline
+}
+
+func (x labelBox) overlaps(y labelBox) bool {
+	return x.a0 < y.a1 && y.a0 < x.a1 && x.b0 < y.b1 && y.b0 < x.b1
+}
+
+// labelText returns the text drawn above a lollipop.
+func (t *Tick) labelText() string {
+	if t.Cnt > 1 {
+		return fmt.Sprintf("%s (%d)", t.label, t.Cnt)
+	}
+	return t.label
+}
+
+// placeLabels decides which lollipops get labels and where they are drawn.
+// Labels are placed in order of decreasing count; a label that would overlap
+// one already placed is lifted (and drawn with a leader line) until it fits,
+// or dropped if it still doesn't fit after maxLabelLifts tries.
+func (d *diagram) placeLabels() {
+	var pops []int
+	for i, t := range d.ticks {
+		if t.isLollipop && t.Cnt >= d.LabelMinCount {
+			pops = append(pops, i)
+		}
+	}
+	sort.SliceStable(pops, func(i, j int) bool {
+		return d.ticks[pops[i]].Cnt > d.ticks[pops[j]].Cnt
+	})
+	if d.LabelTop > 0 && len(pops) > d.LabelTop {
+		pops = pops[:d.LabelTop]
+	}
+
+	// SVG labels are rotated -30 degrees, PNG labels are not rotated (yet)
+	angle := math.Pi / 6.0
+	fontSize := 10.0
+	if d.dpi != 0 {
+		angle = 0
+		fontSize *= d.dpi / 72.0
+	}
+	sin, cos := math.Sin(angle), math.Cos(angle)
+	step := fontSize * 1.2
+
+	var placed []labelBox
+	maxLift := 0.0
+	for _, i := range pops {
+		t := &d.ticks[i]
+		w := float64(d.MeasureFont(t.labelText(), 10))
+
+		for n := 0; n <= maxLabelLifts; n++ {
+			lift := float64(n) * step
+			// text is centered on the anchor, with its baseline offset
+			// 1.5 radii above the anchor (perpendicular to the baseline)
+			y := t.y - lift
+			a := t.x*cos - y*sin
+			b := t.x*sin + y*cos - t.r*1.5
+			box := labelBox{a - w/2, a + w/2, b - fontSize, b}
+
+			fits := true
+			for _, other := range placed {
+				if box.overlaps(other) {
+					fits = false
+					break
+				}
+			}
+			if fits {
+				placed = append(placed, box)
+				t.showLabel = true
+				t.labelLift = lift
+				if lift > maxLift {
+					maxLift = lift
+				}
+				break
+			}
+		}
+	}
+
+	// make room above the lollipops for the lifted labels
+	if maxLift > 0 {
+		d.startY += maxLift
+		d.GraphicHeight += maxLift
+		for i := range d.ticks {
+			d.ticks[i].y += maxLift
+		}
+	}
+}
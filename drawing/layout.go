@@ -0,0 +1,125 @@
+//
+//    Lollipops diagram generation framework for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package drawing
+
+import (
+	"github.com/joiningdata/lollipops/data"
+)
+
+// Layout is the computed position of each diagram element, in the same
+// pixel coordinates as the SVG output, for clients that draw the diagram
+// themselves.
+type Layout struct {
+	Width     float64          `json:"width"`
+	Height    float64          `json:"height"`
+	Length    int              `json:"length"`
+	Lollipops []LayoutLollipop `json:"lollipops"`
+	Domains   []LayoutDomain   `json:"domains"`
+}
+
+// LayoutLollipop is the position of a single lollipop marker.
+type LayoutLollipop struct {
+	Label string  `json:"label"`
+	Pos   int     `json:"pos"`
+	Count int     `json:"count"`
+	Color string  `json:"color"`
+	Class string  `json:"class"`
+	X     float64 `json:"x"`
+	Y     float64 `json:"y"`
+	R     float64 `json:"r"`
+	// LabelShown is set if the label is drawn, LabelLift pixels above
+	// its usual position.
+	LabelShown bool    `json:"label_shown"`
+	LabelLift  float64 `json:"label_lift,omitempty"`
+}
+
+// LayoutDomain is the position of a domain region on the backbone.
+type LayoutDomain struct {
+	Name      string  `json:"name"`
+	Accession string  `json:"accession"`
+	Label     string  `json:"label"`
+	Color     string  `json:"color"`
+	Start     int     `json:"start"`
+	End       int     `json:"end"`
+	Row       int     `json:"row"`
+	X         float64 `json:"x"`
+	Y         float64 `json:"y"`
+	Width     float64 `json:"width"`
+	Height    float64 `json:"height"`
+}
+
+// Layout computes the diagram layout for the provided changes in changelist
+// and domain/region information in g, without rendering it.
+func (s *Settings) Layout(changelist []string, g *data.GraphicResponse) (*Layout, error) {
+	d, err := s.prepare(changelist, g)
+	if err != nil {
+		return nil, err
+	}
+	aaLen, _ := d.g.Length.Int64()
+	scale := (d.GraphicWidth - d.Padding*2) / float64(aaLen)
+
+	res := &Layout{
+		Width:  d.GraphicWidth,
+		Height: d.GraphicHeight,
+		Length: int(aaLen),
+	}
+	startY := d.startY
+	for _, pop := range d.ticks {
+		if !pop.isLollipop {
+			continue
+		}
+		popbot := startY + d.LollipopRadius + d.LollipopHeight + d.densityHeight
+		startY = popbot - (d.DomainHeight-d.BackboneHeight)/2
+		break
+	}
+	for _, pop := range d.ticks {
+		if !pop.isLollipop {
+			continue
+		}
+		res.Lollipops = append(res.Lollipops, LayoutLollipop{
+			Label:      pop.label,
+			Pos:        pop.Pos,
+			Count:      pop.Cnt,
+			Color:      pop.Col,
+			Class:      pop.class,
+			X:          pop.x,
+			Y:          pop.y,
+			R:          pop.r,
+			LabelShown: d.ShowLabels && pop.showLabel,
+			LabelLift:  pop.labelLift,
+		})
+	}
+	for ri, r := range d.g.Regions {
+		start, _ := r.Start.Float64()
+		end, _ := r.End.Float64()
+		res.Domains = append(res.Domains, LayoutDomain{
+			Name:      r.Metadata.Description,
+			Accession: r.Metadata.Identifier,
+			Label:     d.domainLabels[ri],
+			Color:     r.Color,
+			Start:     int(start),
+			End:       int(end),
+			Row:       d.domainRows[ri],
+			X:         d.Padding + start*scale,
+			Y:         startY + float64(d.domainRows[ri])*(d.DomainHeight+d.DomainRowPadding),
+			Width:     (end - start) * scale,
+			Height:    d.DomainHeight,
+		})
+	}
+	return res, nil
+}
@@ -18,13 +18,13 @@
 package drawing
 
 import (
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
 	"image/png"
 	"io"
-	"log"
 
 	"github.com/golang/freetype/truetype"
 	"github.com/joiningdata/lollipops/data"
@@ -32,15 +32,21 @@ import (
 	"golang.org/x/image/math/fixed"
 )
 
-func DrawPNG(w io.Writer, dpi float64, changelist []string, g *data.GraphicResponse) {
+// MaxPNGPixels limits the size of PNG images, larger diagrams return ErrTooLarge.
+var MaxPNGPixels = 100000000
+
+// ErrTooLarge is returned when a diagram is too large to draw.
+var ErrTooLarge = errors.New("diagram is too large to draw")
+
+func DrawPNG(w io.Writer, dpi float64, changelist []string, g *data.GraphicResponse) error {
 	DefaultSettings.dpi = 0
-	DefaultSettings.DrawPNG(w, dpi, changelist, g)
+	return DefaultSettings.DrawPNG(w, dpi, changelist, g)
 }
 
 // DrawPNG writes PNG image to w, with the provided changes in changelist and
 // domain/region information in g. If GraphicWidth=0, then AutoWidth is called
 // to determine the best diagram width to fit all labels.
-func (s *Settings) DrawPNG(w io.Writer, dpi float64, changelist []string, g *data.GraphicResponse) {
+func (s *Settings) DrawPNG(w io.Writer, dpi float64, changelist []string, g *data.GraphicResponse) error {
 	if s.dpi == 0 {
 		dpiScale := dpi / 72.0
 		s.LollipopRadius *= dpiScale
@@ -48,6 +54,10 @@ func (s *Settings) DrawPNG(w io.Writer, dpi float64, changelist []string, g *dat
 		s.BackboneHeight *= dpiScale
 		s.MotifHeight *= dpiScale
 		s.DomainHeight *= dpiScale
+		s.DomainRowPadding *= dpiScale
+		s.TrackHeight *= dpiScale
+		s.DensityHeight *= dpiScale
+		s.TrackPadding *= dpiScale
 		s.Padding *= dpiScale
 		s.AxisPadding *= dpiScale
 		s.AxisHeight *= dpiScale
@@ -55,34 +65,70 @@ func (s *Settings) DrawPNG(w io.Writer, dpi float64, changelist []string, g *dat
 		s.dpi = dpi
 	}
 	if theFont == nil {
-		log.Fatalf("no font loaded - cannot make PNG!")
+		return errors.New("no font loaded - cannot make PNG")
+	}
+	d, err := s.prepare(changelist, g)
+	if err != nil {
+		return err
 	}
-	d := s.prepare(changelist, g)
-	d.png(w)
+	return d.png(w)
 }
 
-func (s *diagram) png(w io.Writer) {
+func (s *diagram) png(w io.Writer) error {
 	aaLen, _ := s.g.Length.Int64()
 	scale := (s.GraphicWidth - s.Padding*2) / float64(aaLen)
 	aaSpace := int((20 * s.dpi / 72.0) / scale)
 
+	if s.GraphicWidth*s.GraphicHeight > float64(MaxPNGPixels) {
+		return ErrTooLarge
+	}
 	img := image.NewRGBA(image.Rect(0, 0, int(s.GraphicWidth), int(s.GraphicHeight)))
-	drawRectWH(img, 0, 0, s.GraphicWidth, s.GraphicHeight, color.White)
+	bgColor := color.RGBA{0xFF, 0xFF, 0xFF, 0xFF}
+	if s.BackgroundColor != "" {
+		bgColor = colorFromHex(s.BackgroundColor)
+	}
+	drawRectWH(img, 0, 0, s.GraphicWidth, s.GraphicHeight, bgColor)
+	backboneColor := colorFromHex(s.BackboneColor)
+	axisColor := colorFromHex(s.AxisColor)
 
 	blackFontDrawer := &font.Drawer{
 		Dst: img,
-		Src: &image.Uniform{color.Black},
-		Face: truetype.NewFace(theFont, &truetype.Options{
+		Src: &image.Uniform{colorFromHex(s.TextColor)},
+		Face: newFace(&truetype.Options{
 			Size:    float64(10.0),
-			DPI:     float64(DefaultSettings.dpi),
+			DPI:     float64(s.dpi),
 			Hinting: font.HintingFull,
 		}),
 	}
+	if s.title != "" {
+		titleDrawer := &font.Drawer{
+			Dst: img,
+			Src: &image.Uniform{colorFromHex(s.TextColor)},
+			Face: newFace(&truetype.Options{
+				Size:    float64(14.0),
+				DPI:     float64(s.dpi),
+				Hinting: font.HintingFull,
+			}),
+			Dot: fixed.P(int(s.Padding), int(s.Padding+14*s.dpi/72.0)),
+		}
+		titleDrawer.DrawString(s.title)
+	}
 	//////
 
 	startY := s.startY
 	poptop := startY + s.LollipopRadius
-	popbot := poptop + s.LollipopHeight
+	popbot := poptop + s.LollipopHeight + s.densityHeight
+
+	for _, h := range s.Hotspots {
+		if h.Type != "cluster" {
+			continue
+		}
+		// shade significant clusters behind the lollipops
+		hot := colorFromHex(s.MutationColor)
+		hot.R, hot.G, hot.B, hot.A = uint8(int(hot.R)*26/255), uint8(int(hot.G)*26/255), uint8(int(hot.B)*26/255), 26
+		drawRectWH(img, s.Padding+(float64(h.Start)-0.5)*scale, s.startY,
+			float64(h.End-h.Start+1)*scale, popbot-s.startY, hot)
+	}
 
 	firstLollipop := true
 	for _, pop := range s.ticks {
@@ -94,29 +140,58 @@ func (s *diagram) png(w io.Writer) {
 			startY = popbot - (s.DomainHeight-s.BackboneHeight)/2
 		}
 
-		c := color.RGBA{0xBA, 0xBD, 0xB6, 0xFF}
-		thickvline(img, int(pop.x-s.dpi/144), int(pop.y), int(popbot), 2*s.dpi/72.0, c)
+		thickvline(img, int(pop.x-s.dpi/144), int(pop.y), int(popbot), 2*s.dpi/72.0, backboneColor)
+		if s.positionHotspot(pop.Pos) != nil {
+			// outline ring around significant positions
+			ring := int(pop.r + 3.5*s.dpi/72.0)
+			drawCircle(img, int(pop.x+s.dpi/144), int(pop.y), ring, colorFromHex(s.TextColor))
+			drawCircle(img, int(pop.x+s.dpi/144), int(pop.y), ring-int(1.5*s.dpi/72.0), bgColor)
+		}
 		drawCircle(img, int(pop.x+s.dpi/144), int(pop.y), int(pop.r), colorFromHex(pop.Col))
 
-		if s.ShowLabels {
-			chg := pop.label
-			if pop.Cnt > 1 {
-				chg = fmt.Sprintf("%s (%d)", chg, pop.Cnt)
+		if s.ShowLabels && pop.showLabel {
+			chg := pop.labelText()
+			if pop.labelLift > 0 {
+				// leader line from the marker up to the lifted label
+				vline(img, int(pop.x), int(pop.y-pop.labelLift-pop.r), int(pop.y-pop.r), backboneColor)
 			}
 
 			// FIXME: rotate label to match SVG output
 			wf := blackFontDrawer.MeasureString(chg)
 			blackFontDrawer.Dot = fixed.Point26_6{
 				X: fixed.I(int(pop.x)) - wf/2,
-				Y: fixed.I(int(pop.y - (pop.r * 1.5))),
+				Y: fixed.I(int(pop.y - pop.labelLift - (pop.r * 1.5))),
 			}
 			blackFontDrawer.DrawString(chg)
 		}
 	}
 
+	if len(s.density) > 0 {
+		// density track just above the domains, hotspots shaded through the backbone
+		bottom := popbot - (s.DomainHeight-s.BackboneHeight)/2 - 2*s.dpi/72.0
+		top := bottom - s.densityHeight + 4*s.dpi/72.0
+		hot := colorFromHex(s.MutationColor)
+		hot.A = 38 // 15% opacity
+		hot.R, hot.G, hot.B = uint8(int(hot.R)*38/255), uint8(int(hot.G)*38/255), uint8(int(hot.B)*38/255)
+		for _, win := range s.denseWindows {
+			x0 := s.Padding + float64(win[0])*scale
+			drawRectWH(img, x0, top, float64(win[1]-win[0])*scale, popbot+s.BackboneHeight-top, hot)
+		}
+		peak := s.densityPeak()
+		fill := colorFromHex(BlendColorStrings(s.AxisColor, s.MotifBlendColor))
+		for px := int(s.Padding); px <= int(s.GraphicWidth-s.Padding); px++ {
+			pos := int((float64(px) - s.Padding) / scale)
+			if pos < 0 || pos >= len(s.density) || peak == 0 {
+				continue
+			}
+			h := s.density[pos] / peak * (bottom - top)
+			vline(img, px, int(bottom-h), int(bottom), fill)
+		}
+	}
+
 	// draw the backbone
 	drawRectWH(img, s.Padding, startY+(s.DomainHeight-s.BackboneHeight)/2, s.GraphicWidth-(s.Padding*2),
-		s.BackboneHeight, color.RGBA{0xBA, 0xBD, 0xB6, 0xFF})
+		s.BackboneHeight, backboneColor)
 
 	if !s.HideMotifs {
 		disFill := color.RGBA{0, 0, 0, 38} // 15% opacity
@@ -141,7 +216,7 @@ func (s *diagram) png(w io.Writer) {
 					swidth, s.BackboneHeight, disFill)
 			} else {
 				drawRectWHShadow(img, s.Padding+sstart, startY+(s.DomainHeight-s.MotifHeight)/2,
-					swidth, s.MotifHeight, colorFromHex(BlendColorStrings(r.Color, "#FFFFFF")),
+					swidth, s.MotifHeight, colorFromHex(BlendColorStrings(r.Color, s.MotifBlendColor)),
 					2*s.dpi/72.0)
 			}
 		}
@@ -149,10 +224,10 @@ func (s *diagram) png(w io.Writer) {
 
 	whiteFontDrawer := &font.Drawer{
 		Dst: img,
-		Src: &image.Uniform{color.White},
-		Face: truetype.NewFace(theFont, &truetype.Options{
+		Src: &image.Uniform{colorFromHex(s.DomainTextColor)},
+		Face: newFace(&truetype.Options{
 			Size:    float64(12.0),
-			DPI:     float64(DefaultSettings.dpi),
+			DPI:     float64(s.dpi),
 			Hinting: font.HintingFull,
 		}),
 	}
@@ -160,7 +235,7 @@ func (s *diagram) png(w io.Writer) {
 	// get font height in px
 	bounds, _, ok := whiteFontDrawer.Face.GlyphBounds('M')
 	if !ok {
-		log.Fatalf("unable to determine font bounds!")
+		return errors.New("unable to determine font bounds")
 	}
 	// add 2px line spacing
 	fontH := bounds.Max.Sub(bounds.Min).Y + fixed.I(2)
@@ -173,23 +248,40 @@ func (s *diagram) png(w io.Writer) {
 		sstart *= scale
 		swidth = (swidth * scale) - sstart
 
-		drawRectWHShadow(img, s.Padding+sstart, startY, swidth, s.DomainHeight, colorFromHex(r.Color), 2*s.dpi/72.0)
+		rowY := startY + float64(s.domainRows[ri])*(s.DomainHeight+s.DomainRowPadding)
+		drawRectWHShadow(img, s.Padding+sstart, rowY, swidth, s.DomainHeight, colorFromHex(r.Color), 2*s.dpi/72.0)
 
 		if swidth > 10 && s.domainLabels[ri] != "" {
 			// center text at x
 			wf := whiteFontDrawer.MeasureString(s.domainLabels[ri])
 			whiteFontDrawer.Dot = fixed.Point26_6{
 				X: fixed.I(int(s.Padding+sstart)) + (fixed.I(int(swidth))-wf)/2,
-				Y: fixed.I(int(startY+s.DomainHeight/2)) + fontH/2,
+				Y: fixed.I(int(rowY+s.DomainHeight/2)) + fontH/2,
 			}
 			whiteFontDrawer.DrawString(s.domainLabels[ri])
 		}
 	}
 
+	// draw the annotation tracks
+	for ti, t := range s.g.Tracks {
+		ty := s.trackY(startY, ti)
+		blackFontDrawer.Dot = fixed.Point26_6{
+			X: fixed.I(int(s.Padding)),
+			Y: fixed.I(int(ty - s.TrackPadding/5)),
+		}
+		blackFontDrawer.DrawString(t.Name)
+		thickhline(img, int(s.Padding), int(s.GraphicWidth-s.Padding), int(ty+s.TrackHeight/2), s.dpi/72.0, axisColor)
+		for _, f := range t.Features {
+			fx, fw := s.featureSpan(f, scale)
+			drawRectWH(img, fx, ty, fw, s.TrackHeight, colorFromHex(f.Color))
+		}
+	}
+
+	startY += s.belowHeight
 	if !s.HideAxis {
 		startY += s.DomainHeight + s.AxisPadding
-		thickhline(img, int(s.Padding), int(s.GraphicWidth-s.Padding+s.dpi/36.0), int(startY), s.dpi/72.0, color.Gray{0xAA})
-		thickvline(img, int(s.Padding), int(startY), int(startY+(s.AxisHeight/3)), s.dpi/72.0, color.Gray{0xAA})
+		thickhline(img, int(s.Padding), int(s.GraphicWidth-s.Padding+s.dpi/36.0), int(startY), s.dpi/72.0, axisColor)
+		thickvline(img, int(s.Padding), int(startY), int(startY+(s.AxisHeight/3)), s.dpi/72.0, axisColor)
 
 		lastDrawn := 0
 		for i, t := range s.ticks {
@@ -202,7 +294,7 @@ func (s *diagram) png(w io.Writer) {
 			}
 			lastDrawn = t.Pos
 			x := s.Padding + (float64(t.Pos) * scale)
-			thickvline(img, int(x), int(startY), int(startY+(s.AxisHeight/3)), s.dpi/72.0, color.Gray{0xAA})
+			thickvline(img, int(x), int(startY), int(startY+(s.AxisHeight/3)), s.dpi/72.0, axisColor)
 
 			// center text at x
 			spos := fmt.Sprint(t.Pos)
@@ -221,9 +313,14 @@ func (s *diagram) png(w io.Writer) {
 	for key, colorstring := range s.legendInfo {
 		startY += legBoxSize * 1.2
 		// 15% darker than backbone (i.e. disordered color)
-		clr := color.RGBA{0x9E, 0xA0, 0x9A, 0xFF}
+		clr := color.RGBA{
+			uint8(float64(backboneColor.R) * 0.85),
+			uint8(float64(backboneColor.G) * 0.85),
+			uint8(float64(backboneColor.B) * 0.85),
+			0xFF,
+		}
 		if key != data.MotifNames["disorder"] {
-			clr = colorFromHex(BlendColorStrings(colorstring, "#FFFFFF"))
+			clr = colorFromHex(BlendColorStrings(colorstring, s.MotifBlendColor))
 		}
 		drawRectWHShadow(img, legBoxSize, startY, legBoxSize, legBoxSize, clr, 2*s.dpi/72.0)
 
@@ -234,7 +331,7 @@ func (s *diagram) png(w io.Writer) {
 		blackFontDrawer.DrawString(key)
 	}
 
-	png.Encode(w, img)
+	return png.Encode(w, img)
 }
 
 ///////////
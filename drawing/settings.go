@@ -17,12 +17,34 @@
 
 package drawing
 
+import "github.com/joiningdata/lollipops/analysis"
+
 // Settings contains all the configurable options for lollipop diagram generation.
 type Settings struct {
 	// ShowLegend adds a color-coding legend above the diagram.
 	ShowLegend bool
+	// ShowTitle adds a title line above the diagram.
+	ShowTitle bool
+	// Title is the text of the title line. If empty, it is built from the
+	// gene name, protein name, organism and UniProt accession of the protein.
+	Title string
 	// ShowLabels adds mutation label text above lollipops markers.
 	ShowLabels bool
+	// LabelMinCount hides mutation labels for lollipops with a count below this value.
+	LabelMinCount int
+	// LabelTop limits mutation labels to the lollipops with the highest counts,
+	// if >0.
+	LabelTop int
+	// ShowDensity adds a mutation density track between the lollipops and the
+	// backbone, and shades windows with significantly more mutations than expected.
+	ShowDensity bool
+	// Hotspots are the significant variant positions and clusters to
+	// highlight, as found by analysis.FindHotspots.
+	Hotspots []analysis.Hotspot `json:"-"`
+	// Samples maps a protein change, as given in the changelist but without
+	// its @COUNT tag, to the IDs of the samples it was found in. They are
+	// listed in the HTML report's tooltips and variant table.
+	Samples map[string][]string `json:"-"`
 	// HideDisordered hides disordered regions on the backbone even if motifs are shown.
 	HideDisordered bool
 	// HideMotifs hides motifs in the output image.
@@ -32,17 +54,51 @@ type Settings struct {
 
 	// SolidFillOnly ensures no patterns are used in output files.
 	SolidFillOnly bool
+	// UseStylesheet moves the SVG text styles and theme colors into a <style>
+	// block (targeting the element classes) instead of inline attributes.
+	UseStylesheet bool
+	// EmbedFont embeds the loaded TrueType font (reduced to the glyphs used)
+	// in SVG output, so text renders with the same metrics used for layout.
+	EmbedFont bool
 
 	// DomainLabelStyle determines how to deal with domain labels that do not fit
 	// within the colored domain blocks. Values are "off", "fit" (only labels that
 	// fully fit), and "truncated" (default, remove text to fit within).
 	DomainLabelStyle string
 
+	// DomainLayout determines how overlapping domain regions are drawn. Values
+	// are "overlap" (default, all domains on the backbone) and "stacked" (pack
+	// overlapping domains into additional rows below the backbone).
+	DomainLayout string
+
 	// SynonymousColor is the #RRGGBB color to use for synonymous mutations.
 	SynonymousColor string
 	// MutationColor is the #RRGGBB color to use for non-synonymous mutations.
 	MutationColor string
 
+	// DomainPalette is a list of #RRGGBB colors to assign to domains by
+	// accession. If empty, the colors provided with the domain data are used.
+	DomainPalette []string
+	// DomainColors overrides the #RRGGBB color of domain regions. Keys are
+	// matched against the domain accession, short name, or description.
+	DomainColors map[string]string
+
+	// BackgroundColor is the #RRGGBB color of the image background. If empty,
+	// SVG output has a transparent background and PNG output is white.
+	BackgroundColor string
+	// BackboneColor is the #RRGGBB color of the backbone and lollipop sticks.
+	BackboneColor string
+	// MotifBlendColor is the #RRGGBB color motif colors are blended with.
+	MotifBlendColor string
+	// AxisColor is the #RRGGBB color of the axis lines and ticks.
+	AxisColor string
+	// TextColor is the #RRGGBB color of the axis and legend text.
+	TextColor string
+	// LabelColor is the #RRGGBB color of the mutation label text.
+	LabelColor string
+	// DomainTextColor is the #RRGGBB color of the domain label text.
+	DomainTextColor string
+
 	// LollipopRadius is the size of the marker at the top of the "stick".
 	LollipopRadius float64
 	// LollipopHeight is the length of the "stick" connecting the backbone to the marker.
@@ -53,6 +109,18 @@ type Settings struct {
 	MotifHeight float64
 	// DomainHeight is the thickness of a domain region.
 	DomainHeight float64
+	// DomainRowPadding is the amount of whitespace between stacked domain rows.
+	DomainRowPadding float64
+	// DensityHeight is the height of the mutation density track.
+	DensityHeight float64
+	// DensityBandwidth is the width (in amino acids) of the density smoothing
+	// kernel, if <=0 then it is determined from the protein length.
+	DensityBandwidth float64
+	// TrackHeight is the thickness of the features in an annotation track.
+	TrackHeight float64
+	// TrackPadding is the amount of space above each annotation track,
+	// including room for the track name.
+	TrackPadding float64
 	// Padding is the amount of whitespace added to each side of the image.
 	Padding float64
 	// AxisPadding is the amount of whitespace added between the axis and backbone.
@@ -85,10 +153,18 @@ var DefaultSettings = Settings{
 	SolidFillOnly:  false,
 
 	DomainLabelStyle: "truncated",
+	DomainLayout:     "overlap",
 
 	SynonymousColor: "#0000ff",
 	MutationColor:   "#ff0000",
 
+	BackboneColor:   "#BABDB6",
+	MotifBlendColor: "#FFFFFF",
+	AxisColor:       "#AAAAAA",
+	TextColor:       "#000000",
+	LabelColor:      "#555555",
+	DomainTextColor: "#FFFFFF",
+
 	LollipopRadius: 4,
 	LollipopHeight: 28,
 	BackboneHeight: 14,
@@ -98,4 +174,9 @@ var DefaultSettings = Settings{
 	AxisPadding:    10,
 	AxisHeight:     15,
 	TextPadding:    5,
+
+	DomainRowPadding: 4,
+	DensityHeight:    24,
+	TrackHeight:      8,
+	TrackPadding:     14,
 }
@@ -0,0 +1,233 @@
+//
+//    Lollipops diagram generation framework for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package drawing
+
+import (
+	"encoding/binary"
+	"errors"
+	"sort"
+
+	"github.com/golang/freetype/truetype"
+)
+
+var errNotSubsettable = errors.New("font cannot be subset")
+
+type sfntTable struct {
+	tag  string
+	data []byte
+}
+
+// subsetFont returns a copy of the TrueType font ttf in which the outlines of
+// all glyphs not needed to draw the runes in used are removed. Glyph indices
+// and all other tables are kept as-is, so the result is a valid font that only
+// renders the used characters, but is usually a small fraction of the size.
+func subsetFont(f *truetype.Font, ttf []byte, used map[rune]bool) ([]byte, error) {
+	tables, err := readSFNT(ttf)
+	if err != nil {
+		return nil, err
+	}
+	head, maxp, loca, glyf := tables["head"], tables["maxp"], tables["loca"], tables["glyf"]
+	if len(head) < 54 || len(maxp) < 6 || loca == nil || glyf == nil {
+		return nil, errNotSubsettable
+	}
+	numGlyphs := int(binary.BigEndian.Uint16(maxp[4:]))
+	longLoca := binary.BigEndian.Uint16(head[50:]) != 0
+
+	offsets := make([]uint32, numGlyphs+1)
+	for i := range offsets {
+		if longLoca {
+			if len(loca) < 4*(i+1) {
+				return nil, errNotSubsettable
+			}
+			offsets[i] = binary.BigEndian.Uint32(loca[4*i:])
+		} else {
+			if len(loca) < 2*(i+1) {
+				return nil, errNotSubsettable
+			}
+			offsets[i] = 2 * uint32(binary.BigEndian.Uint16(loca[2*i:]))
+		}
+	}
+	glyph := func(i int) []byte {
+		if i >= numGlyphs || offsets[i] > offsets[i+1] || int(offsets[i+1]) > len(glyf) {
+			return nil
+		}
+		return glyf[offsets[i]:offsets[i+1]]
+	}
+
+	// always keep .notdef, then every glyph used (and their components)
+	keep := map[int]bool{0: true}
+	queue := []int{0}
+	for r := range used {
+		queue = append(queue, int(f.Index(r)))
+	}
+	for len(queue) > 0 {
+		gi := queue[0]
+		queue = queue[1:]
+		keep[gi] = true
+		for _, c := range glyphComponents(glyph(gi)) {
+			if !keep[c] {
+				queue = append(queue, c)
+			}
+		}
+	}
+
+	// rebuild glyf and a long-format loca with only the kept outlines
+	var newGlyf []byte
+	newLoca := make([]byte, 4*(numGlyphs+1))
+	for i := 0; i < numGlyphs; i++ {
+		binary.BigEndian.PutUint32(newLoca[4*i:], uint32(len(newGlyf)))
+		if keep[i] {
+			newGlyf = append(newGlyf, glyph(i)...)
+			for len(newGlyf)%4 != 0 {
+				newGlyf = append(newGlyf, 0)
+			}
+		}
+	}
+	binary.BigEndian.PutUint32(newLoca[4*numGlyphs:], uint32(len(newGlyf)))
+
+	newHead := append([]byte{}, head...)
+	binary.BigEndian.PutUint16(newHead[50:], 1)
+	tables["head"] = newHead
+	tables["loca"] = newLoca
+	tables["glyf"] = newGlyf
+	// a digital signature would no longer be valid
+	delete(tables, "DSIG")
+
+	return writeSFNT(tables), nil
+}
+
+// glyphComponents returns the glyph indices referenced by a composite glyph.
+func glyphComponents(g []byte) []int {
+	if len(g) < 10 || int16(binary.BigEndian.Uint16(g)) >= 0 {
+		return nil
+	}
+	const (
+		argsAreWords    = 0x0001
+		haveScale       = 0x0008
+		moreComponents  = 0x0020
+		haveXYScale     = 0x0040
+		haveTwoByTwo    = 0x0080
+		componentHeader = 4
+	)
+	var res []int
+	p := 10
+	for p+componentHeader <= len(g) {
+		flags := binary.BigEndian.Uint16(g[p:])
+		res = append(res, int(binary.BigEndian.Uint16(g[p+2:])))
+		p += componentHeader
+		if flags&argsAreWords != 0 {
+			p += 4
+		} else {
+			p += 2
+		}
+		switch {
+		case flags&haveScale != 0:
+			p += 2
+		case flags&haveXYScale != 0:
+			p += 4
+		case flags&haveTwoByTwo != 0:
+			p += 8
+		}
+		if flags&moreComponents == 0 {
+			break
+		}
+	}
+	return res
+}
+
+// readSFNT splits a TrueType font file into its tables.
+func readSFNT(ttf []byte) (map[string][]byte, error) {
+	if len(ttf) < 12 {
+		return nil, errNotSubsettable
+	}
+	if v := binary.BigEndian.Uint32(ttf); v != 0x00010000 && v != 0x74727565 { // 'true'
+		return nil, errNotSubsettable
+	}
+	numTables := int(binary.BigEndian.Uint16(ttf[4:]))
+	if len(ttf) < 12+16*numTables {
+		return nil, errNotSubsettable
+	}
+	tables := make(map[string][]byte, numTables)
+	for i := 0; i < numTables; i++ {
+		rec := ttf[12+16*i:]
+		offset := binary.BigEndian.Uint32(rec[8:])
+		length := binary.BigEndian.Uint32(rec[12:])
+		if uint64(offset)+uint64(length) > uint64(len(ttf)) {
+			return nil, errNotSubsettable
+		}
+		tables[string(rec[:4])] = ttf[offset : offset+length]
+	}
+	return tables, nil
+}
+
+// writeSFNT assembles a TrueType font file from its tables, computing the
+// table checksums and the head table's checksum adjustment.
+func writeSFNT(tables map[string][]byte) []byte {
+	tags := make([]string, 0, len(tables))
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	n := len(tags)
+	entrySelector := 0
+	for 1<<(entrySelector+1) <= n {
+		entrySelector++
+	}
+	searchRange := (1 << entrySelector) * 16
+
+	out := make([]byte, 12+16*n)
+	binary.BigEndian.PutUint32(out, 0x00010000)
+	binary.BigEndian.PutUint16(out[4:], uint16(n))
+	binary.BigEndian.PutUint16(out[6:], uint16(searchRange))
+	binary.BigEndian.PutUint16(out[8:], uint16(entrySelector))
+	binary.BigEndian.PutUint16(out[10:], uint16(n*16-searchRange))
+
+	headOffset := -1
+	for i, tag := range tags {
+		data := tables[tag]
+		if tag == "head" {
+			data = append([]byte{}, data...)
+			binary.BigEndian.PutUint32(data[8:], 0)
+			headOffset = len(out)
+		}
+		rec := out[12+16*i:]
+		copy(rec, tag)
+		binary.BigEndian.PutUint32(rec[4:], sfntChecksum(data))
+		binary.BigEndian.PutUint32(rec[8:], uint32(len(out)))
+		binary.BigEndian.PutUint32(rec[12:], uint32(len(data)))
+		out = append(out, data...)
+		for len(out)%4 != 0 {
+			out = append(out, 0)
+		}
+	}
+	if headOffset >= 0 {
+		binary.BigEndian.PutUint32(out[headOffset+8:], 0xB1B0AFBA-sfntChecksum(out))
+	}
+	return out
+}
+
+func sfntChecksum(data []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(data); i += 4 {
+		var word [4]byte
+		copy(word[:], data[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
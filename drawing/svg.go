@@ -18,57 +18,103 @@
 package drawing
 
 import (
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
+	"strings"
 
 	"github.com/joiningdata/lollipops/data"
 )
 
-const svgHeader = `<?xml version='1.0'?>
-<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="%f" height="%f">
-<defs>
-  <filter id="ds" x="0" y="0">
-    <feOffset in="SourceAlpha" dx="2" dy="2" />
-    <feComponentTransfer><feFuncA type="linear" slope="0.2"/></feComponentTransfer>
-    <feGaussianBlur result="blurOut" stdDeviation="1" />
-    <feBlend in="SourceGraphic" in2="blurOut" mode="normal" />
-  </filter>
-  <pattern id="disordered-hatch" patternUnits="userSpaceOnUse" width="4" height="4">
-    <path d="M-1,1 l2,-2 M0,4 l4,-4 M3,5 l2,-2" stroke="#000000" opacity="0.3" />
-  </pattern>
-</defs>
-`
-const svgFooter = `</svg>`
-
-func DrawSVG(w io.Writer, changelist []string, g *data.GraphicResponse) {
-	d := DefaultSettings.prepare(changelist, g)
-	d.svg(w)
+func DrawSVG(w io.Writer, changelist []string, g *data.GraphicResponse) error {
+	return DefaultSettings.DrawSVG(w, changelist, g)
 }
 
 // DrawSVG writes the SVG XML document to w, with the provided changes in changelist
 // and domain/region information in g. If GraphicWidth=0, the AutoWidth is called
-// to determine the best diagram width to fit all labels.
-func (s *Settings) DrawSVG(w io.Writer, changelist []string, g *data.GraphicResponse) {
-	d := s.prepare(changelist, g)
-	d.svg(w)
+// to determine the best diagram width to fit all labels. It fails if EmbedFont
+// is set but no font is loaded.
+func (s *Settings) DrawSVG(w io.Writer, changelist []string, g *data.GraphicResponse) error {
+	d, err := s.prepare(changelist, g)
+	if err != nil {
+		return err
+	}
+	return d.svg(w)
+}
+
+// svgDefs writes the filters and patterns referenced by the diagram elements.
+func svgDefs(x *svgWriter) {
+	x.start("defs")
+	x.start("filter", "id", "ds", "x", "0", "y", "0")
+	x.elem("feOffset", "in", "SourceAlpha", "dx", "2", "dy", "2")
+	x.start("feComponentTransfer")
+	x.elem("feFuncA", "type", "linear", "slope", "0.2")
+	x.end("feComponentTransfer")
+	x.elem("feGaussianBlur", "result", "blurOut", "stdDeviation", "1")
+	x.elem("feBlend", "in", "SourceGraphic", "in2", "blurOut", "mode", "normal")
+	x.end("filter")
+	x.start("pattern", "id", "disordered-hatch", "patternUnits", "userSpaceOnUse", "width", "4", "height", "4")
+	x.elem("path", "d", "M-1,1 l2,-2 M0,4 l4,-4 M3,5 l2,-2", "stroke", "#000000", "opacity", "0.3")
+	x.end("pattern")
+	x.end("defs")
+	x.newline()
 }
 
-func (s *diagram) svg(w io.Writer) {
+func (s *diagram) svg(w io.Writer) error {
+	if s.EmbedFont && (theFont == nil || FontName == "") {
+		return errors.New("no font loaded - cannot embed font in SVG")
+	}
 	aaLen, _ := s.g.Length.Int64()
 	scale := (s.GraphicWidth - s.Padding*2) / float64(aaLen)
 	aaSpace := int(20 / scale)
 	fontSpec := ""
 	if FontName != "" {
-		fontSpec = "font-family:" + FontName + ";"
+		fontSpec = "font-family:" + FontName + ", sans-serif;"
+	}
+
+	x := newSVGWriter(w)
+	x.token(xml.ProcInst{Target: "xml", Inst: []byte("version='1.0'")})
+	x.newline()
+	x.start("svg", "xmlns", "http://www.w3.org/2000/svg", "xmlns:xlink", "http://www.w3.org/1999/xlink",
+		"width", fstr(s.GraphicWidth), "height", fstr(s.GraphicHeight),
+		"viewBox", fmt.Sprintf("0 0 %f %f", s.GraphicWidth, s.GraphicHeight))
+	x.newline()
+	svgDefs(x)
+	if s.UseStylesheet {
+		x.text("style", s.stylesheet(fontSpec))
+		x.newline()
+	}
+	if s.BackgroundColor != "" {
+		x.elem("rect", "class", "background", "fill", s.BackgroundColor, "x", "0", "y", "0",
+			"width", fstr(s.GraphicWidth), "height", fstr(s.GraphicHeight))
 	}
+	ids := make(map[string]int)
 
-	fmt.Fprintf(w, svgHeader, s.GraphicWidth, s.GraphicHeight)
+	if s.title != "" {
+		x.text("text", s.title, s.textStyle("title", 14, fontSpec, s.TextColor,
+			"text-anchor", "start", "x", fstr(s.Padding), "y", fstr(s.Padding+14))...)
+		x.newline()
+	}
 
 	//////
 
 	startY := s.startY
 	poptop := startY + s.LollipopRadius
-	popbot := poptop + s.LollipopHeight
+	popbot := poptop + s.LollipopHeight + s.densityHeight
+
+	for _, h := range s.Hotspots {
+		if h.Type != "cluster" {
+			continue
+		}
+		// shade significant clusters behind the lollipops
+		x.start("a", "xlink:title", fmt.Sprintf("hotspot cluster %d-%d (%d, q=%.3g)", h.Start, h.End, h.Count, h.Q))
+		x.elem("rect", s.themed("hotspot-cluster", "fill", s.MutationColor, "opacity", "0.1",
+			"x", fstr(s.Padding+(float64(h.Start)-0.5)*scale), "y", fstr(s.startY),
+			"width", fstr(float64(h.End-h.Start+1)*scale), "height", fstr(popbot-s.startY))...)
+		x.end("a")
+		x.newline()
+	}
 
 	firstLollipop := true
 	for _, pop := range s.ticks {
@@ -80,30 +126,79 @@ func (s *diagram) svg(w io.Writer) {
 			startY = popbot - (s.DomainHeight-s.BackboneHeight)/2
 		}
 
-		fmt.Fprintf(w, `<line x1="%f" x2="%f" y1="%f" y2="%f" stroke="#BABDB6" stroke-width="2"/>`, pop.x, pop.x, pop.y, popbot)
-		fmt.Fprintf(w, `<a xlink:title="%s"><circle cx="%f" cy="%f" r="%f" fill="%s" /></a>`,
-			pop.label, pop.x, pop.y, pop.r, pop.Col)
+		x.start("g", "class", fmt.Sprintf("lollipop pos-%d class-%s", pop.Pos, pop.class),
+			"id", uniqueID(ids, "lollipop-"+cssName(pop.label)))
+		x.elem("line", s.themed("stick", "x1", fstr(pop.x), "x2", fstr(pop.x), "y1", fstr(pop.y), "y2", fstr(popbot),
+			"stroke", s.BackboneColor, "stroke-width", "2")...)
+		attrs := []string{"xlink:title", pop.label, "data-label", pop.label, "data-count", fmt.Sprint(pop.Cnt),
+			"data-domain", strings.Join(s.regionsAt(pop.Pos), ", ")}
+		if len(pop.samples) > 0 {
+			attrs = append(attrs, "data-samples", strings.Join(pop.samples, ", "))
+		}
+		x.start("a", attrs...)
+		x.elem("circle", "cx", fstr(pop.x), "cy", fstr(pop.y), "r", fstr(pop.r), "fill", pop.Col)
+		x.end("a")
+		if h := s.positionHotspot(pop.Pos); h != nil {
+			x.start("a", "xlink:title", fmt.Sprintf("hotspot %d (%d, q=%.3g)", h.Start, h.Count, h.Q))
+			x.elem("circle", s.themed("hotspot-ring", "cx", fstr(pop.x), "cy", fstr(pop.y), "r", fstr(pop.r+2),
+				"fill", "none", "stroke", s.TextColor, "stroke-width", "1.5")...)
+			x.end("a")
+		}
 
-		if s.ShowLabels {
-			fmt.Fprintf(w, `<g transform="translate(%f,%f) rotate(-30)">`,
-				pop.x, pop.y)
-			chg := pop.label
-			if pop.Cnt > 1 {
-				chg = fmt.Sprintf("%s (%d)", chg, pop.Cnt)
+		if s.ShowLabels && pop.showLabel {
+			if pop.labelLift > 0 {
+				// leader line from the marker up to the lifted label
+				x.elem("line", s.themed("leader", "x1", fstr(pop.x), "x2", fstr(pop.x),
+					"y1", fstr(pop.y-pop.r), "y2", fstr(pop.y-pop.labelLift-pop.r),
+					"stroke", s.LabelColor, "stroke-width", "0.5")...)
+			}
+			x.start("g", "transform", fmt.Sprintf("translate(%f,%f) rotate(-30)", pop.x, pop.y-pop.labelLift))
+			x.text("text", pop.labelText(), s.textStyle("lollipop-label", 10, fontSpec, s.LabelColor,
+				"text-anchor", "middle", "x", "0", "y", fstr(pop.r*-1.5))...)
+			x.end("g")
+		}
+		x.end("g")
+		x.newline()
+	}
+
+	if len(s.density) > 0 {
+		// density track just above the domains, hotspots shaded through the backbone
+		bottom := popbot - (s.DomainHeight-s.BackboneHeight)/2 - 2
+		top := bottom - s.densityHeight + 4
+		x.start("g", "class", "density")
+		for _, win := range s.denseWindows {
+			x.start("a", "xlink:title", fmt.Sprintf("dense region %d-%d", win[0], win[1]))
+			x.elem("rect", s.themed("hotspot", "fill", s.MutationColor, "opacity", "0.15",
+				"x", fstr(s.Padding+float64(win[0])*scale), "y", fstr(top),
+				"width", fstr(float64(win[1]-win[0])*scale), "height", fstr(popbot+s.BackboneHeight-top))...)
+			x.end("a")
+		}
+		peak := s.densityPeak()
+		path := &strings.Builder{}
+		fmt.Fprintf(path, "M%f,%f", s.Padding, bottom)
+		for pos, v := range s.density {
+			h := 0.0
+			if peak > 0 {
+				h = v / peak * (bottom - top)
 			}
-			fmt.Fprintf(w, `<text style="font-size:10px;%sfill:#555;" text-anchor="middle" x="0" y="%f">%s</text></g>`,
-				fontSpec, (pop.r * -1.5), chg)
+			fmt.Fprintf(path, " L%f,%f", s.Padding+float64(pos)*scale, bottom-h)
 		}
+		fmt.Fprintf(path, " L%f,%f Z", s.Padding+float64(len(s.density)-1)*scale, bottom)
+		x.elem("path", s.themed("density-area", "d", path.String(), "fill", s.AxisColor, "fill-opacity", "0.5")...)
+		x.end("g")
+		x.newline()
 	}
 
 	// draw the backbone
-	fmt.Fprintf(w, `<a xlink:title="%s, %s (%daa)"><rect fill="#BABDB6" x="%f" y="%f" width="%f" height="%f"/></a>`,
-		s.g.Metadata.Identifier, s.g.Metadata.Description, aaLen,
-		s.Padding, startY+(s.DomainHeight-s.BackboneHeight)/2, s.GraphicWidth-(s.Padding*2), s.BackboneHeight)
+	x.start("a", "xlink:title", fmt.Sprintf("%s, %s (%daa)", s.g.Metadata.Identifier, s.g.Metadata.Description, aaLen))
+	x.elem("rect", s.themed("backbone", "fill", s.BackboneColor, "x", fstr(s.Padding), "y", fstr(startY+(s.DomainHeight-s.BackboneHeight)/2),
+		"width", fstr(s.GraphicWidth-(s.Padding*2)), "height", fstr(s.BackboneHeight))...)
+	x.end("a")
 
-	disFill := "url(#disordered-hatch)"
+	// disFill are the fill attributes for disordered regions
+	disFill := []string{"fill", "url(#disordered-hatch)"}
 	if s.SolidFillOnly {
-		disFill = `#000;" opacity="0.15`
+		disFill = []string{"fill", "#000", "opacity", "0.15"}
 	}
 	if !s.HideMotifs {
 		// draw transmembrane, signal peptide, coiled-coil, etc motifs
@@ -120,16 +215,21 @@ func (s *diagram) svg(w io.Writer) {
 			sstart *= scale
 			swidth = (swidth * scale) - sstart
 
-			fmt.Fprintf(w, `<a xlink:title="%s">`, r.Type)
+			x.start("g", "class", "motif "+cssName(r.Type))
+			x.start("a", "xlink:title", r.Type)
 			if r.Type == "disorder" {
 				// draw disordered regions with a understated diagonal hatch pattern
-				fmt.Fprintf(w, `<rect fill="%s" x="%f" y="%f" width="%f" height="%f"/>`, disFill,
-					s.Padding+sstart, startY+(s.DomainHeight-s.BackboneHeight)/2, swidth, s.BackboneHeight)
+				x.elem("rect", append(disFill,
+					"x", fstr(s.Padding+sstart), "y", fstr(startY+(s.DomainHeight-s.BackboneHeight)/2),
+					"width", fstr(swidth), "height", fstr(s.BackboneHeight))...)
 			} else {
-				fmt.Fprintf(w, `<rect fill="%s" x="%f" y="%f" width="%f" height="%f" filter="url(#ds)"/>`, BlendColorStrings(r.Color, "#FFFFFF"),
-					s.Padding+sstart, startY+(s.DomainHeight-s.MotifHeight)/2, swidth, s.MotifHeight)
+				x.elem("rect", "fill", BlendColorStrings(r.Color, s.MotifBlendColor),
+					"x", fstr(s.Padding+sstart), "y", fstr(startY+(s.DomainHeight-s.MotifHeight)/2),
+					"width", fstr(swidth), "height", fstr(s.MotifHeight), "filter", "url(#ds)")
 			}
-			fmt.Fprintln(w, `</a>`)
+			x.end("a")
+			x.end("g")
+			x.newline()
 		}
 	}
 
@@ -141,20 +241,53 @@ func (s *diagram) svg(w io.Writer) {
 		sstart *= scale
 		swidth = (swidth * scale) - sstart
 
-		fmt.Fprintf(w, `<g transform="translate(%f,%f)"><a xlink:href="%s" xlink:title="%s">`, s.Padding+sstart, startY, r.Link, r.Metadata.Description)
-		fmt.Fprintf(w, `<rect fill="%s" x="0" y="0" width="%f" height="%f" filter="url(#ds)"/>`, r.Color, swidth, s.DomainHeight)
+		rowY := startY + float64(s.domainRows[ri])*(s.DomainHeight+s.DomainRowPadding)
+		name := r.Metadata.Identifier
+		if name == "" {
+			name = r.Text
+		}
+		x.start("g", "class", "domain "+cssName(name), "id", uniqueID(ids, "domain-"+cssName(name)),
+			"transform", fmt.Sprintf("translate(%f,%f)", s.Padding+sstart, rowY))
+		x.start("a", "xlink:href", r.Link, "xlink:title", r.Metadata.Description)
+		x.elem("rect", "fill", r.Color, "x", "0", "y", "0", "width", fstr(swidth), "height", fstr(s.DomainHeight),
+			"filter", "url(#ds)")
 		if swidth > 10 && s.domainLabels[ri] != "" {
-			fmt.Fprintf(w, `<text style="font-size:12px;%sfill:#ffffff;" text-anchor="middle" x="%f" y="%f">%s</text>`,
-				fontSpec, swidth/2.0, 4+s.DomainHeight/2, s.domainLabels[ri])
+			x.text("text", s.domainLabels[ri], s.textStyle("domain-label", 12, fontSpec, s.DomainTextColor,
+				"text-anchor", "middle", "x", fstr(swidth/2.0), "y", fstr(4+s.DomainHeight/2))...)
 		}
-		fmt.Fprintln(w, `</a></g>`)
+		x.end("a")
+		x.end("g")
+		x.newline()
 	}
 
+	// draw the annotation tracks
+	for ti, t := range s.g.Tracks {
+		ty := s.trackY(startY, ti)
+		x.start("g", "class", "track", "id", uniqueID(ids, "track-"+cssName(t.Name)))
+		x.text("text", t.Name, s.textStyle("track-label", 10, fontSpec, s.TextColor,
+			"text-anchor", "start", "x", fstr(s.Padding), "y", fstr(ty-s.TrackPadding/5))...)
+		x.elem("line", s.themed("track-line", "x1", fstr(s.Padding), "x2", fstr(s.GraphicWidth-s.Padding),
+			"y1", fstr(ty+s.TrackHeight/2), "y2", fstr(ty+s.TrackHeight/2), "stroke", s.AxisColor)...)
+		for _, f := range t.Features {
+			fx, fw := s.featureSpan(f, scale)
+			x.start("a", "xlink:title", f.Metadata.Description)
+			x.elem("rect", "class", "track-feature "+cssName(f.Type), "fill", f.Color,
+				"x", fstr(fx), "y", fstr(ty), "width", fstr(fw), "height", fstr(s.TrackHeight))
+			x.end("a")
+		}
+		x.end("g")
+		x.newline()
+	}
+
+	startY += s.belowHeight
 	if !s.HideAxis {
 		startY += s.DomainHeight + s.AxisPadding
-		fmt.Fprintln(w, `<g class="axis">`)
-		fmt.Fprintf(w, `<line x1="%f" x2="%f" y1="%f" y2="%f" stroke="#AAAAAA" />`, s.Padding, s.GraphicWidth-s.Padding, startY, startY)
-		fmt.Fprintf(w, `<line x1="%f" x2="%f" y1="%f" y2="%f" stroke="#AAAAAA" />`, s.Padding, s.Padding, startY, startY+(s.AxisHeight/3))
+		x.start("g", "class", "axis")
+		x.newline()
+		x.elem("line", s.themed("axis-line", "x1", fstr(s.Padding), "x2", fstr(s.GraphicWidth-s.Padding),
+			"y1", fstr(startY), "y2", fstr(startY), "stroke", s.AxisColor)...)
+		x.elem("line", s.themed("axis-tick", "x1", fstr(s.Padding), "x2", fstr(s.Padding),
+			"y1", fstr(startY), "y2", fstr(startY+(s.AxisHeight/3)), "stroke", s.AxisColor)...)
 
 		lastDrawn := 0
 		for i, t := range s.ticks {
@@ -166,25 +299,94 @@ func (s *diagram) svg(w io.Writer) {
 				continue
 			}
 			lastDrawn = t.Pos
-			x := s.Padding + (float64(t.Pos) * scale)
-			fmt.Fprintf(w, `<line x1="%f" x2="%f" y1="%f" y2="%f" stroke="#AAAAAA" />`, x, x, startY, startY+(s.AxisHeight/3))
-			fmt.Fprintf(w, `<text style="font-size:10px;%sfill:#000000;" text-anchor="middle" x="%f" y="%f">%d</text>`,
-				fontSpec, x, startY+s.AxisHeight, t.Pos)
+			tx := s.Padding + (float64(t.Pos) * scale)
+			x.elem("line", s.themed("axis-tick", "x1", fstr(tx), "x2", fstr(tx),
+				"y1", fstr(startY), "y2", fstr(startY+(s.AxisHeight/3)), "stroke", s.AxisColor)...)
+			x.text("text", fmt.Sprint(t.Pos), s.textStyle("axis-label", 10, fontSpec, s.TextColor,
+				"text-anchor", "middle", "x", fstr(tx), "y", fstr(startY+s.AxisHeight))...)
 		}
 
-		fmt.Fprintln(w, "</g>")
+		x.end("g")
+		x.newline()
 		startY += s.AxisHeight
 	}
 
 	for key, color := range s.legendInfo {
 		startY += 14.0
+		fill := []string{"fill", color}
 		if key == data.MotifNames["disorder"] {
-			color = disFill
+			fill = disFill
 		}
-		fmt.Fprintf(w, `<rect fill="%s" x="4" y="%f" width="12" height="12" filter="url(#ds)"/>`, color, startY)
-		fmt.Fprintf(w, `<text style="font-size:12px;%sfill:#000000;" text-anchor="start" x="20" y="%f">%s</text>`,
-			fontSpec, startY+12, key) // 12=font height-baseline
+		x.start("g", "class", "legend-item")
+		x.elem("rect", append(fill, "x", "4", "y", fstr(startY), "width", "12", "height", "12", "filter", "url(#ds)")...)
+		x.text("text", key, s.textStyle("legend-label", 12, fontSpec, s.TextColor,
+			"text-anchor", "start", "x", "20", "y", fstr(startY+12))...) // 12=font height-baseline
+		x.end("g")
+	}
+
+	if s.EmbedFont {
+		// @font-face rules apply to the whole document, so this can be
+		// written last, once all the characters used are known
+		x.text("style", fontFaceCSS(x.runes))
+		x.newline()
 	}
+	x.end("svg")
+	x.newline()
+	return x.flush()
+}
 
-	fmt.Fprintln(w, svgFooter)
+// themed adds the class name to an element's attributes. When a stylesheet
+// is used, the theme color attributes (fill and stroke) are left to the
+// stylesheet instead.
+func (s *diagram) themed(class string, kv ...string) []string {
+	res := []string{"class", class}
+	for i := 0; i < len(kv); i += 2 {
+		if s.UseStylesheet && (kv[i] == "fill" || kv[i] == "stroke") {
+			continue
+		}
+		res = append(res, kv[i], kv[i+1])
+	}
+	return res
+}
+
+// textStyle returns the class and (unless a stylesheet is used) inline style
+// attributes for text elements, followed by the additional attributes in kv.
+func (s *diagram) textStyle(class string, size int, fontSpec, color string, kv ...string) []string {
+	res := []string{"class", class}
+	if !s.UseStylesheet {
+		res = append(res, "style", fmt.Sprintf("font-size:%dpx;%sfill:%s;", size, fontSpec, color))
+	}
+	return append(res, kv...)
+}
+
+// stylesheet returns the CSS rules that replace inline styles and theme
+// colors when UseStylesheet is set.
+func (s *diagram) stylesheet(fontSpec string) string {
+	rules := []string{
+		fmt.Sprintf("text { %s }", fontSpec),
+		fmt.Sprintf(".lollipop-label { font-size:10px; fill:%s; }", s.LabelColor),
+		fmt.Sprintf(".domain-label { font-size:12px; fill:%s; }", s.DomainTextColor),
+		fmt.Sprintf(".axis-label { font-size:10px; fill:%s; }", s.TextColor),
+		fmt.Sprintf(".legend-label { font-size:12px; fill:%s; }", s.TextColor),
+		fmt.Sprintf(".title { font-size:14px; fill:%s; }", s.TextColor),
+		fmt.Sprintf(".backbone { fill:%s; }", s.BackboneColor),
+		fmt.Sprintf(".stick { stroke:%s; }", s.BackboneColor),
+		fmt.Sprintf(".leader { stroke:%s; }", s.LabelColor),
+		fmt.Sprintf(".axis-line, .axis-tick, .track-line { stroke:%s; }", s.AxisColor),
+		fmt.Sprintf(".density-area { fill:%s; }", s.AxisColor),
+		fmt.Sprintf(".hotspot, .hotspot-cluster { fill:%s; }", s.MutationColor),
+		fmt.Sprintf(".hotspot-ring { fill:none; stroke:%s; }", s.TextColor),
+		fmt.Sprintf(".track-label { font-size:10px; fill:%s; }", s.TextColor),
+	}
+	return "\n" + strings.Join(rules, "\n") + "\n"
+}
+
+// uniqueID returns base, or base with a numeric suffix if it has already
+// been used in the document.
+func uniqueID(ids map[string]int, base string) string {
+	ids[base]++
+	if n := ids[base]; n > 1 {
+		return fmt.Sprintf("%s-%d", base, n)
+	}
+	return base
 }
@@ -0,0 +1,189 @@
+//
+//    Lollipops diagram generation framework for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package drawing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joiningdata/lollipops/data"
+)
+
+var record = flag.Bool("record", false, "fetch and save the responses in testdata/recorded (needs network access)")
+
+// recordedAccessions are UniProt entries whose domain names and feature
+// descriptions contain XML special characters, such as the apostrophes in
+// "5'-3' exonuclease" of E. coli DNA polymerase I.
+var recordedAccessions = []string{"P00582"}
+
+// TestSVGWellFormed renders a hand-made response whose names, descriptions
+// and links have XML special characters added, and checks that the output
+// parses as XML and still carries the original text.
+func TestSVGWellFormed(t *testing.T) {
+	g := loadResponse(t, "testdata/special_chars.json")
+	checkSVG(t, g, []string{
+		g.Regions[0].Link,
+		g.Regions[1].Link,
+		g.Regions[1].Metadata.Description,
+		g.Regions[2].Metadata.Description,
+		g.Tracks[0].Name,
+		g.Metadata.Description,
+	})
+}
+
+// TestSVGRecorded renders the InterPro and UniProt responses saved in
+// testdata/recorded, as for TestSVGWellFormed. Run it with -record to fetch
+// them again.
+func TestSVGRecorded(t *testing.T) {
+	if *record {
+		if err := os.MkdirAll("testdata/recorded", 0755); err != nil {
+			t.Fatal(err)
+		}
+		for _, acc := range recordedAccessions {
+			g, err := data.GetGraphicData(context.Background(), acc, &data.FetchOptions{
+				Domains: "interpro",
+				Tracks:  []string{"sites"},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := json.MarshalIndent(g, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join("testdata/recorded", acc+".json"), b, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	files, _ := filepath.Glob("testdata/recorded/*.json")
+	if len(files) == 0 {
+		t.Skip("no recorded responses, run with -record to fetch them")
+	}
+	for _, fn := range files {
+		g := loadResponse(t, fn)
+		want := []string{g.Metadata.Description}
+		for _, r := range g.Regions {
+			want = append(want, r.Link, r.Metadata.Description)
+		}
+		checkSVG(t, g, want)
+	}
+}
+
+func loadResponse(t *testing.T, filename string) *data.GraphicResponse {
+	t.Helper()
+	f, err := os.Open(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	g := &data.GraphicResponse{}
+	if err := json.NewDecoder(f).Decode(g); err != nil {
+		t.Fatalf("%s: %s", filename, err)
+	}
+	return g
+}
+
+// checkSVG draws g with several settings, and checks that each SVG parses
+// as XML and that every string in want is found in its text or attributes.
+func checkSVG(t *testing.T, g *data.GraphicResponse, want []string) {
+	t.Helper()
+	if err := LoadDefaultFont(); err != nil {
+		t.Fatal(err)
+	}
+	changes := []string{"R175H", "R248Q@12", "R273C#ff00ff", "R273H@8", "P72Rfs"}
+
+	variants := map[string]func(s *Settings){
+		"default": func(s *Settings) {},
+		"labeled": func(s *Settings) {
+			s.ShowLabels = true
+			s.ShowLegend = true
+			s.ShowTitle = true
+		},
+		"stylesheet": func(s *Settings) {
+			s.ShowLegend = true
+			s.ShowTitle = true
+			s.Title = `Custom & "quoted" <title>`
+			s.UseStylesheet = true
+			s.EmbedFont = true
+		},
+	}
+	for name, setup := range variants {
+		s := DefaultSettings.Clone()
+		setup(s)
+
+		var buf bytes.Buffer
+		if err := s.DrawSVG(&buf, changes, g); err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+
+		var text []string
+		dec := xml.NewDecoder(&buf)
+		for {
+			tok, err := dec.Token()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("%s: invalid SVG: %s", name, err)
+			}
+			switch tok := tok.(type) {
+			case xml.StartElement:
+				for _, a := range tok.Attr {
+					text = append(text, a.Value)
+				}
+			case xml.CharData:
+				text = append(text, string(tok))
+			}
+		}
+
+		all := strings.Join(text, "\n")
+		for _, w := range want {
+			if !strings.Contains(all, w) {
+				t.Errorf("%s: %q is missing from the SVG", name, w)
+			}
+		}
+	}
+}
+
+// TestSVGEmbedNoFont checks that embedding a font fails, without writing
+// anything, when no font is loaded.
+func TestSVGEmbedNoFont(t *testing.T) {
+	font, name := theFont, FontName
+	theFont, FontName = nil, ""
+	defer func() { theFont, FontName = font, name }()
+
+	s := DefaultSettings.Clone()
+	s.EmbedFont = true
+	var buf bytes.Buffer
+	if err := s.DrawSVG(&buf, []string{"R175H"}, &data.GraphicResponse{Length: "400"}); err == nil {
+		t.Error("expected an error")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("wrote %d bytes", buf.Len())
+	}
+}
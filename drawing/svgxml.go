@@ -0,0 +1,100 @@
+//
+//    Lollipops diagram generation framework for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package drawing
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+)
+
+// svgWriter emits SVG elements through an XML encoder so that all attribute
+// values and text content are escaped properly. The first error encountered
+// is kept and returned by flush.
+type svgWriter struct {
+	enc *xml.Encoder
+	err error
+
+	// runes records every character written in text elements.
+	runes map[rune]bool
+}
+
+func newSVGWriter(w io.Writer) *svgWriter {
+	return &svgWriter{enc: xml.NewEncoder(w), runes: make(map[rune]bool)}
+}
+
+func (x *svgWriter) token(t xml.Token) {
+	if x.err == nil {
+		x.err = x.enc.EncodeToken(t)
+	}
+}
+
+// attrs converts a list of alternating attribute names and values to xml.Attrs.
+func attrs(kv []string) []xml.Attr {
+	if len(kv)%2 != 0 {
+		panic("svgWriter: odd number of attribute names and values")
+	}
+	res := make([]xml.Attr, 0, len(kv)/2)
+	for i := 0; i < len(kv); i += 2 {
+		res = append(res, xml.Attr{Name: xml.Name{Local: kv[i]}, Value: kv[i+1]})
+	}
+	return res
+}
+
+// start opens an element with the alternating attribute names and values in kv.
+func (x *svgWriter) start(name string, kv ...string) {
+	x.token(xml.StartElement{Name: xml.Name{Local: name}, Attr: attrs(kv)})
+}
+
+// end closes the most recently opened element called name.
+func (x *svgWriter) end(name string) {
+	x.token(xml.EndElement{Name: xml.Name{Local: name}})
+}
+
+// elem writes an element without any content.
+func (x *svgWriter) elem(name string, kv ...string) {
+	x.start(name, kv...)
+	x.end(name)
+}
+
+// text writes an element containing only the (escaped) text content.
+func (x *svgWriter) text(name, content string, kv ...string) {
+	for _, r := range content {
+		x.runes[r] = true
+	}
+	x.start(name, kv...)
+	x.token(xml.CharData(content))
+	x.end(name)
+}
+
+// newline adds a line break between elements to keep the output readable.
+func (x *svgWriter) newline() {
+	x.token(xml.CharData("\n"))
+}
+
+func (x *svgWriter) flush() error {
+	if x.err == nil {
+		x.err = x.enc.Flush()
+	}
+	return x.err
+}
+
+// fstr formats a coordinate for use as an attribute value.
+func fstr(v float64) string {
+	return fmt.Sprintf("%f", v)
+}
@@ -0,0 +1,143 @@
+//
+//    Lollipops diagram generation framework for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package drawing
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Theme is a named set of colors that are applied to Settings together.
+type Theme struct {
+	// DomainPalette is the list of colors assigned to domains (nil keeps
+	// the colors provided with the domain data).
+	DomainPalette []string
+
+	SynonymousColor string
+	MutationColor   string
+
+	BackgroundColor string
+	BackboneColor   string
+	MotifBlendColor string
+	AxisColor       string
+	TextColor       string
+	LabelColor      string
+	DomainTextColor string
+}
+
+// Themes contains the built-in color themes by name.
+var Themes = map[string]Theme{
+	"default": {
+		SynonymousColor: "#0000ff",
+		MutationColor:   "#ff0000",
+		BackboneColor:   "#BABDB6",
+		MotifBlendColor: "#FFFFFF",
+		AxisColor:       "#AAAAAA",
+		TextColor:       "#000000",
+		LabelColor:      "#555555",
+		DomainTextColor: "#FFFFFF",
+	},
+
+	// Okabe & Ito (2008) colorblind-safe palette
+	"okabe-ito": {
+		DomainPalette: []string{
+			"#E69F00", "#56B4E9", "#009E73", "#F0E442",
+			"#0072B2", "#D55E00", "#CC79A7", "#999999",
+		},
+		SynonymousColor: "#0072B2",
+		MutationColor:   "#D55E00",
+		BackboneColor:   "#BBBBBB",
+		MotifBlendColor: "#FFFFFF",
+		AxisColor:       "#999999",
+		TextColor:       "#000000",
+		LabelColor:      "#444444",
+		DomainTextColor: "#000000",
+	},
+
+	// perceptually uniform, colorblind-friendly viridis samples
+	"viridis": {
+		DomainPalette: []string{
+			"#440154", "#482878", "#3E4A89", "#31688E",
+			"#26828E", "#1F9E89", "#35B779", "#6DCD59",
+		},
+		SynonymousColor: "#35B779",
+		MutationColor:   "#440154",
+		BackboneColor:   "#C8C8C8",
+		MotifBlendColor: "#FFFFFF",
+		AxisColor:       "#AAAAAA",
+		TextColor:       "#000000",
+		LabelColor:      "#444444",
+		DomainTextColor: "#FFFFFF",
+	},
+
+	"grayscale": {
+		DomainPalette: []string{
+			"#252525", "#525252", "#737373", "#969696",
+		},
+		SynonymousColor: "#A0A0A0",
+		MutationColor:   "#000000",
+		BackboneColor:   "#D9D9D9",
+		MotifBlendColor: "#FFFFFF",
+		AxisColor:       "#AAAAAA",
+		TextColor:       "#000000",
+		LabelColor:      "#444444",
+		DomainTextColor: "#FFFFFF",
+	},
+
+	"dark": {
+		SynonymousColor: "#6B9BFF",
+		MutationColor:   "#FF6B6B",
+		BackgroundColor: "#1E1E1E",
+		BackboneColor:   "#5A5A5A",
+		MotifBlendColor: "#1E1E1E",
+		AxisColor:       "#888888",
+		TextColor:       "#E0E0E0",
+		LabelColor:      "#BBBBBB",
+		DomainTextColor: "#FFFFFF",
+	},
+}
+
+// ThemeNames returns the sorted names of the built-in themes.
+func ThemeNames() []string {
+	names := make([]string, 0, len(Themes))
+	for name := range Themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ApplyTheme sets all of the colors in s from the named theme.
+func (s *Settings) ApplyTheme(name string) error {
+	t, ok := Themes[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("unknown theme '%s' (available: %s)", name, strings.Join(ThemeNames(), ", "))
+	}
+	s.DomainPalette = t.DomainPalette
+	s.SynonymousColor = t.SynonymousColor
+	s.MutationColor = t.MutationColor
+	s.BackgroundColor = t.BackgroundColor
+	s.BackboneColor = t.BackboneColor
+	s.MotifBlendColor = t.MotifBlendColor
+	s.AxisColor = t.AxisColor
+	s.TextColor = t.TextColor
+	s.LabelColor = t.LabelColor
+	s.DomainTextColor = t.DomainTextColor
+	return nil
+}
@@ -20,13 +20,13 @@ package drawing
 import (
 	"fmt"
 	"math"
-	"regexp"
 	"strings"
 
+	"github.com/joiningdata/lollipops/analysis"
 	"github.com/joiningdata/lollipops/data"
 )
 
-var stripChangePos = regexp.MustCompile("(^|[A-Za-z]*)([0-9]+)([A-Za-z]*)")
+var stripChangePos = analysis.ChangePattern
 
 type Tick struct {
 	Pos int
@@ -36,9 +36,14 @@ type Tick struct {
 
 	isLollipop bool
 	label      string
+	class      string
+	samples    []string
 	x          float64
 	y          float64
 	r          float64
+
+	showLabel bool
+	labelLift float64
 }
 
 type TickSlice []Tick
@@ -66,6 +71,43 @@ func (t TickSlice) Less(i, j int) bool {
 	return t[i].Pos < t[j].Pos
 }
 
+// changeClass categorizes the protein change chg as "synonymous", "missense",
+// "nonsense" or "frameshift", using its stripChangePos submatches in cpos.
+// Stops (*, X or Ter) and frameshifts (any fs suffix, e.g. P72Rfs*12) are
+// recognized before the residues are compared.
+func changeClass(chg string, cpos []string) string {
+	if len(cpos) != 4 {
+		return "synonymous"
+	}
+	// everything after the position, without any @COUNT or #COLOR tags
+	alt := chg[strings.Index(chg, cpos[0])+len(cpos[0])-len(cpos[3]):]
+	if i := strings.IndexAny(alt, "@#"); i != -1 {
+		alt = alt[:i]
+	}
+	alt = strings.ToLower(alt)
+	if strings.Contains(alt, "fs") {
+		return "frameshift"
+	}
+	if alt == "*" || alt == "x" || alt == "ter" || alt == "stop" {
+		return "nonsense"
+	}
+	if alt == "" || alt == "=" || alt == strings.ToLower(cpos[1]) {
+		return "synonymous"
+	}
+	return "missense"
+}
+
+// cssName replaces any characters that are not valid in a CSS class name or
+// XML ID with '-'.
+func cssName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' {
+			return r
+		}
+		return '-'
+	}, s)
+}
+
 // BlendColorStrings blends two CSS #RRGGBB colors together with a straight average.
 func BlendColorStrings(a, b string) string {
 	var r1, g1, b1, r2, g2, b2 int
@@ -75,7 +117,7 @@ func BlendColorStrings(a, b string) string {
 }
 
 // AutoWidth automatically determines the best width to use to fit all
-// available domain names into the plot.
+// available domain names (and the title, if shown) into the plot.
 func (s *Settings) AutoWidth(g *data.GraphicResponse) float64 {
 	aaLen, _ := g.Length.Float64()
 	w := 400.0
@@ -95,6 +137,11 @@ func (s *Settings) AutoWidth(g *data.GraphicResponse) float64 {
 			w = ww
 		}
 	}
+	if s.ShowTitle {
+		if tw := float64(s.MeasureFont(s.titleText(g.Metadata), 14)); tw > w {
+			w = tw
+		}
+	}
 	return w + (s.Padding * 2)
 }
 
@@ -0,0 +1,70 @@
+//
+//    Lollipops diagram generation framework for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package drawing
+
+import (
+	"testing"
+
+	"github.com/joiningdata/lollipops/data"
+)
+
+// TestChangeClasses checks the class of each change, and that the marker
+// colors are still chosen by comparing the residues only.
+func TestChangeClasses(t *testing.T) {
+	if err := LoadDefaultFont(); err != nil {
+		t.Fatal(err)
+	}
+	s := DefaultSettings.Clone()
+	syn, mut := s.SynonymousColor, s.MutationColor
+	cases := []struct {
+		change string
+		class  string
+		color  string
+	}{
+		{"R175H", "missense", mut},
+		{"R213R", "synonymous", syn},
+		{"R213=", "synonymous", syn},
+		{"R213X", "nonsense", mut},
+		{"R213*", "nonsense", syn},
+		{"R213Ter", "nonsense", mut},
+		{"P72Rfs", "frameshift", mut},
+		{"P72fs*12", "frameshift", mut},
+	}
+	var changes []string
+	for _, c := range cases {
+		changes = append(changes, c.change)
+	}
+	l, err := s.Layout(changes, &data.GraphicResponse{Length: "400"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]LayoutLollipop)
+	for _, pop := range l.Lollipops {
+		got[pop.Label] = pop
+	}
+	for _, c := range cases {
+		pop, ok := got[c.change]
+		if !ok {
+			t.Errorf("%s: not drawn", c.change)
+			continue
+		}
+		if pop.Class != c.class || pop.Color != c.color {
+			t.Errorf("%s: got %s %s, expected %s %s", c.change, pop.Class, pop.Color, c.class, c.color)
+		}
+	}
+}
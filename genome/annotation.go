@@ -0,0 +1,274 @@
+//
+//    Lollipops diagram generation framework for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package genome
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Transcript is the coding sequence structure of a single transcript.
+type Transcript struct {
+	ID     string
+	Gene   string
+	Chrom  string
+	Strand byte // '+' or '-'
+	// CDS are the [start,end] coding regions in 1-based inclusive genomic
+	// coordinates, in ascending order, including the stop codon.
+	CDS [][2]int
+	// Phase is the number of bases before the first complete codon, from
+	// the phase of the 5'-most CDS feature. It is only non-zero when the
+	// 5' end of the coding sequence is incomplete.
+	Phase int
+}
+
+// CDSLength returns the number of coding bases in the transcript.
+func (t *Transcript) CDSLength() int {
+	n := 0
+	for _, c := range t.CDS {
+		n += c[1] - c[0] + 1
+	}
+	return n
+}
+
+// LoadTranscript reads a GTF or GFF3 annotation file (optionally gzipped)
+// and returns the transcript named name. The name may be a transcript ID
+// (with or without its version suffix) or a gene name or ID, in which case
+// the transcript with the longest coding sequence is used.
+func LoadTranscript(filename, name string) (*Transcript, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(filename, ".gz") {
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	ts, err := readCDS(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", filename, err)
+	}
+	if t, ok := ts[name]; ok {
+		return t, nil
+	}
+	var best *Transcript
+	for id, t := range ts {
+		if stripVersion(id) == stripVersion(name) {
+			return t, nil
+		}
+		if t.Gene == name && (best == nil || t.CDSLength() > best.CDSLength() ||
+			(t.CDSLength() == best.CDSLength() && t.ID < best.ID)) {
+			best = t
+		}
+	}
+	if best == nil {
+		return nil, fmt.Errorf("no coding transcript named %s in %s", name, filename)
+	}
+	return best, nil
+}
+
+func stripVersion(id string) string {
+	if i := strings.LastIndex(id, "."); i > 0 {
+		if _, err := strconv.Atoi(id[i+1:]); err == nil {
+			return id[:i]
+		}
+	}
+	return id
+}
+
+// readCDS collects the CDS and stop_codon features of every transcript in a
+// GTF or GFF3 file. GTF files from Ensembl and GENCODE leave the stop codon
+// out of the CDS features, so it is added back from the stop_codon feature.
+// The attribute syntax is detected on each line.
+func readCDS(r io.Reader) (map[string]*Transcript, error) {
+	ts := make(map[string]*Transcript)
+	// the 5'-most CDS feature of each transcript and its phase
+	first := make(map[*Transcript][2]int)
+	// GFF3 transcripts refer to their gene by ID
+	geneNames := make(map[string]string)
+	transcriptGenes := make(map[string]string)
+
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 1<<20), 1<<20)
+	lineNum := 0
+	for s.Scan() {
+		lineNum++
+		line := s.Text()
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		p := strings.Split(line, "\t")
+		if len(p) < 9 {
+			continue
+		}
+		attrs := parseAttributes(p[8])
+		ftype := p[2]
+
+		switch ftype {
+		case "gene":
+			if id, ok := attrs["ID"]; ok {
+				geneNames[id] = firstOf(attrs, "Name", "gene_name", "gene")
+			}
+			continue
+		case "mRNA", "transcript":
+			if id, ok := attrs["ID"]; ok {
+				transcriptGenes[id] = attrs["Parent"]
+			}
+			continue
+		case "CDS", "stop_codon":
+		default:
+			continue
+		}
+
+		start, err1 := strconv.Atoi(p[3])
+		end, err2 := strconv.Atoi(p[4])
+		if err1 != nil || err2 != nil || (p[6] != "+" && p[6] != "-") {
+			return nil, fmt.Errorf("line %d: invalid %s feature", lineNum, ftype)
+		}
+		phase := 0
+		if ftype == "CDS" && p[7] != "." {
+			phase, err1 = strconv.Atoi(p[7])
+			if err1 != nil || phase < 0 || phase > 2 {
+				return nil, fmt.Errorf("line %d: invalid CDS phase %s", lineNum, p[7])
+			}
+		}
+
+		var ids []string
+		gene := ""
+		if tid, ok := attrs["transcript_id"]; ok {
+			// GTF
+			ids = []string{tid}
+			gene = firstOf(attrs, "gene_name", "gene_id")
+		} else if parent, ok := attrs["Parent"]; ok {
+			// GFF3, a CDS may be shared by several transcripts
+			ids = strings.Split(parent, ",")
+			gene = firstOf(attrs, "gene_name", "gene")
+		}
+		for _, id := range ids {
+			t, ok := ts[id]
+			if !ok {
+				t = &Transcript{ID: id, Gene: gene, Chrom: p[0], Strand: p[6][0]}
+				ts[id] = t
+			}
+			t.CDS = append(t.CDS, [2]int{start, end})
+			if ftype != "CDS" {
+				continue
+			}
+			// the 5' end is the start on the + strand and the end on the -
+			end5 := start
+			if t.Strand == '-' {
+				end5 = -end
+			}
+			if f, ok := first[t]; !ok || end5 < f[0] {
+				first[t] = [2]int{end5, phase}
+			}
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	aliases := make(map[string]*Transcript)
+	for id, t := range ts {
+		if t.Gene == "" {
+			t.Gene = geneNames[transcriptGenes[id]]
+		}
+		// GFF3 IDs are often prefixed, e.g. "transcript:ENST00000269305"
+		if i := strings.Index(id, ":"); i != -1 {
+			aliases[id[i+1:]] = t
+		}
+		sort.Slice(t.CDS, func(i, j int) bool { return t.CDS[i][0] < t.CDS[j][0] })
+		t.CDS = mergeRegions(t.CDS)
+		t.Phase = first[t][1]
+	}
+	for id, t := range aliases {
+		if _, exists := ts[id]; !exists {
+			ts[id] = t
+		}
+	}
+	return ts, nil
+}
+
+// mergeRegions joins sorted regions that overlap or touch, such as a CDS and
+// the stop codon that follows it.
+func mergeRegions(regions [][2]int) [][2]int {
+	var res [][2]int
+	for _, r := range regions {
+		n := len(res)
+		if n > 0 && r[0] <= res[n-1][1]+1 {
+			if r[1] > res[n-1][1] {
+				res[n-1][1] = r[1]
+			}
+			continue
+		}
+		res = append(res, r)
+	}
+	return res
+}
+
+// parseAttributes parses GTF (key "value"; ...) or GFF3 (key=value;...)
+// attributes. Only the first value of repeated GTF keys is kept.
+func parseAttributes(col string) map[string]string {
+	res := make(map[string]string)
+	for _, part := range strings.Split(col, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if i := strings.Index(part, "="); i != -1 && !strings.Contains(part[:i], " ") {
+			val, err := url.PathUnescape(part[i+1:])
+			if err != nil {
+				val = part[i+1:]
+			}
+			res[part[:i]] = val
+			continue
+		}
+		kv := strings.SplitN(part, " ", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		if _, ok := res[kv[0]]; !ok {
+			res[kv[0]] = strings.Trim(strings.TrimSpace(kv[1]), `"`)
+		}
+	}
+	return res
+}
+
+func firstOf(attrs map[string]string, keys ...string) string {
+	for _, k := range keys {
+		if v, ok := attrs[k]; ok {
+			return v
+		}
+	}
+	return ""
+}
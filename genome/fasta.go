@@ -0,0 +1,187 @@
+//
+//    Lollipops diagram generation framework for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package genome converts genomic variants into protein changes using a
+// local gene annotation (GTF or GFF3) and reference genome (FASTA).
+package genome
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// FASTA provides access to the sequences of a reference genome file. If a
+// samtools .fai index is present next to the file, sequences are read from
+// disk as needed, otherwise each requested sequence is loaded into memory.
+type FASTA struct {
+	f     *os.File
+	index map[string]faiEntry
+	seqs  map[string][]byte
+}
+
+type faiEntry struct {
+	length    int64
+	offset    int64
+	lineBases int64
+	lineWidth int64
+}
+
+// OpenFASTA opens a FASTA file, using filename+".fai" as its index if it exists.
+func OpenFASTA(filename string) (*FASTA, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	fa := &FASTA{f: f, seqs: make(map[string][]byte)}
+	if idx, err := os.Open(filename + ".fai"); err == nil {
+		fa.index, err = readFAI(idx)
+		idx.Close()
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s.fai: %s", filename, err)
+		}
+	}
+	return fa, nil
+}
+
+// Close closes the underlying file.
+func (fa *FASTA) Close() error {
+	return fa.f.Close()
+}
+
+func readFAI(r io.Reader) (map[string]faiEntry, error) {
+	res := make(map[string]faiEntry)
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		p := strings.Split(s.Text(), "\t")
+		if len(p) < 5 {
+			continue
+		}
+		var e faiEntry
+		var err error
+		for i, dst := range []*int64{&e.length, &e.offset, &e.lineBases, &e.lineWidth} {
+			*dst, err = strconv.ParseInt(p[i+1], 10, 64)
+			if err != nil {
+				return nil, err
+			}
+		}
+		res[p[0]] = e
+	}
+	return res, s.Err()
+}
+
+// seqName returns the name used in the file for chrom, allowing for "chr"
+// prefix differences (e.g. "17" and "chr17").
+func (fa *FASTA) seqName(chrom string) (string, bool) {
+	alts := []string{chrom, "chr" + chrom, strings.TrimPrefix(chrom, "chr")}
+	if fa.index != nil {
+		for _, name := range alts {
+			if _, ok := fa.index[name]; ok {
+				return name, true
+			}
+		}
+		return "", false
+	}
+	for _, name := range alts {
+		if _, ok := fa.seqs[name]; ok {
+			return name, true
+		}
+	}
+	for _, name := range alts {
+		if fa.load(name) == nil {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// load reads the sequence named name from an unindexed file into memory.
+func (fa *FASTA) load(name string) error {
+	if _, err := fa.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	var seq []byte
+	found := false
+	s := bufio.NewScanner(fa.f)
+	s.Buffer(make([]byte, 1<<20), 1<<20)
+	for s.Scan() {
+		line := s.Bytes()
+		if len(line) > 0 && line[0] == '>' {
+			if found {
+				break
+			}
+			fields := strings.Fields(string(line[1:]))
+			found = len(fields) > 0 && fields[0] == name
+			continue
+		}
+		if found {
+			seq = append(seq, bytes.TrimSpace(line)...)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("sequence %s not found", name)
+	}
+	fa.seqs[name] = seq
+	return nil
+}
+
+// Fetch returns the (upper case) bases from start to end inclusive, in
+// 1-based coordinates, on the forward strand of chrom.
+func (fa *FASTA) Fetch(chrom string, start, end int) (string, error) {
+	name, ok := fa.seqName(chrom)
+	if !ok {
+		return "", fmt.Errorf("sequence %s not found in reference", chrom)
+	}
+	if start < 1 || end < start {
+		return "", fmt.Errorf("invalid range %s:%d-%d", chrom, start, end)
+	}
+
+	if fa.index == nil {
+		seq := fa.seqs[name]
+		if end > len(seq) {
+			return "", fmt.Errorf("range %s:%d-%d is past the end of the sequence", chrom, start, end)
+		}
+		return strings.ToUpper(string(seq[start-1 : end])), nil
+	}
+
+	e := fa.index[name]
+	if int64(end) > e.length {
+		return "", fmt.Errorf("range %s:%d-%d is past the end of the sequence", chrom, start, end)
+	}
+	pos0, pos1 := int64(start-1), int64(end)
+	off0 := e.offset + (pos0/e.lineBases)*e.lineWidth + pos0%e.lineBases
+	off1 := e.offset + (pos1/e.lineBases)*e.lineWidth + pos1%e.lineBases
+	buf := make([]byte, off1-off0)
+	if _, err := fa.f.ReadAt(buf, off0); err != nil && err != io.EOF {
+		return "", err
+	}
+	buf = bytes.Map(func(r rune) rune {
+		if r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, buf)
+	return strings.ToUpper(string(buf)), nil
+}
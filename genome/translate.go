@@ -0,0 +1,77 @@
+//
+//    Lollipops diagram generation framework for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package genome
+
+import "strings"
+
+// codonTable is the standard genetic code, with '*' for stop codons.
+var codonTable = map[string]byte{}
+
+func init() {
+	const bases = "TCAG"
+	const aminos = "FFLLSSSSYY**CC*WLLLLPPPPHHQQRRRRIIIMTTTTNNKKSSRRVVVVAAAADDEEGGGG"
+	i := 0
+	for _, a := range bases {
+		for _, b := range bases {
+			for _, c := range bases {
+				codonTable[string([]rune{a, b, c})] = aminos[i]
+				i++
+			}
+		}
+	}
+}
+
+// Translate translates a coding sequence up to and including the first stop
+// codon ('*'). Codons with ambiguous bases are translated as 'X', and any
+// trailing partial codon is ignored.
+func Translate(cds string) string {
+	var sb strings.Builder
+	for i := 0; i+3 <= len(cds); i += 3 {
+		aa, ok := codonTable[cds[i:i+3]]
+		if !ok {
+			aa = 'X'
+		}
+		sb.WriteByte(aa)
+		if aa == '*' {
+			break
+		}
+	}
+	return sb.String()
+}
+
+// ReverseComplement returns the reverse complement of a DNA sequence.
+func ReverseComplement(seq string) string {
+	res := make([]byte, len(seq))
+	for i := 0; i < len(seq); i++ {
+		var c byte
+		switch seq[i] {
+		case 'A':
+			c = 'T'
+		case 'C':
+			c = 'G'
+		case 'G':
+			c = 'C'
+		case 'T':
+			c = 'A'
+		default:
+			c = 'N'
+		}
+		res[len(seq)-1-i] = c
+	}
+	return string(res)
+}
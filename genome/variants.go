@@ -0,0 +1,294 @@
+//
+//    Lollipops diagram generation framework for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package genome
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Consequence classes of a protein change.
+const (
+	Synonymous       = "synonymous"
+	Missense         = "missense"
+	Nonsense         = "nonsense"
+	Frameshift       = "frameshift"
+	InframeDeletion  = "inframe_deletion"
+	InframeInsertion = "inframe_insertion"
+	InframeIndel     = "inframe_indel"
+	StartLost        = "start_lost"
+	StopLost         = "stop_lost"
+)
+
+// ErrNotCoding is returned for variants outside of the coding sequence.
+var ErrNotCoding = errors.New("variant is outside the coding sequence")
+
+// Variant is a genomic SNV or indel in 1-based coordinates. Ref and Alt may
+// include a shared anchor base (as in VCF), and an empty allele may be given
+// as "" or "-".
+type Variant struct {
+	Chrom string
+	Pos   int
+	Ref   string
+	Alt   string
+}
+
+func (v Variant) String() string {
+	ref, alt := v.Ref, v.Alt
+	if ref == "" {
+		ref = "-"
+	}
+	if alt == "" {
+		alt = "-"
+	}
+	return fmt.Sprintf("%s:%d %s>%s", v.Chrom, v.Pos, ref, alt)
+}
+
+var variantPattern = regexp.MustCompile(`(?i)^(\S+?)[:\s-]+(\d+)[:\s-]*([ACGTN]+|-)\s*[>:/\s-]\s*([ACGTN]+|-)$`)
+
+// ParseVariant parses a genomic variant such as "chr17:7673802 C>T",
+// "chr17:7673802:C:T" or "17-7673802-C-T".
+func ParseVariant(s string) (Variant, error) {
+	m := variantPattern.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil {
+		return Variant{}, fmt.Errorf("unable to parse genomic variant '%s'", s)
+	}
+	v := Variant{Chrom: m[1], Ref: strings.ToUpper(m[3]), Alt: strings.ToUpper(m[4])}
+	v.Pos, _ = strconv.Atoi(m[2])
+	if v.Ref == "-" {
+		v.Ref = ""
+	}
+	if v.Alt == "-" {
+		v.Alt = ""
+	}
+	return v, nil
+}
+
+// Change is the effect of a genomic variant on the protein.
+type Change struct {
+	Variant Variant
+	// Label is the protein change in the format used for lollipops, e.g.
+	// "R273C", "R213X" or "P72fs".
+	Label string
+	// Pos is the first affected amino acid position.
+	Pos   int
+	Class string
+}
+
+// Annotator converts genomic variants into protein changes for a transcript.
+type Annotator struct {
+	t *Transcript
+	// gseq is the coding sequence on the forward strand, and index maps
+	// each coding genomic position to its offset in gseq.
+	gseq    string
+	index   map[int]int
+	protein string
+}
+
+// NewAnnotator reads the coding sequence of t from the reference genome.
+func NewAnnotator(t *Transcript, ref *FASTA) (*Annotator, error) {
+	if len(t.CDS) == 0 {
+		return nil, fmt.Errorf("transcript %s has no coding sequence", t.ID)
+	}
+	a := &Annotator{t: t, index: make(map[int]int)}
+	var sb strings.Builder
+	for _, c := range t.CDS {
+		seq, err := ref.Fetch(t.Chrom, c[0], c[1])
+		if err != nil {
+			return nil, err
+		}
+		for pos := c[0]; pos <= c[1]; pos++ {
+			a.index[pos] = sb.Len() + pos - c[0]
+		}
+		sb.WriteString(seq)
+	}
+	a.gseq = sb.String()
+	if t.Phase >= len(a.gseq) {
+		return nil, fmt.Errorf("transcript %s has no complete codon", t.ID)
+	}
+	a.protein = a.translate(a.gseq)
+	return a, nil
+}
+
+// Protein returns the translated reference protein sequence.
+func (a *Annotator) Protein() string {
+	return a.protein
+}
+
+// coding returns a forward strand sequence in the transcript's orientation.
+func (a *Annotator) coding(seq string) string {
+	if a.t.Strand == '-' {
+		return ReverseComplement(seq)
+	}
+	return seq
+}
+
+// translate translates a forward strand coding sequence from the first
+// complete codon.
+func (a *Annotator) translate(seq string) string {
+	return Translate(a.coding(seq)[a.t.Phase:])
+}
+
+func sameChrom(a, b string) bool {
+	return strings.TrimPrefix(a, "chr") == strings.TrimPrefix(b, "chr")
+}
+
+// Annotate returns the protein change caused by v. Variants that are not
+// entirely within one coding exon (including splice site variants) return
+// an error.
+func (a *Annotator) Annotate(v Variant) (*Change, error) {
+	if !sameChrom(v.Chrom, a.t.Chrom) {
+		return nil, ErrNotCoding
+	}
+	// the whole reference allele, including any anchor bases that are
+	// removed below, must match the genome where it is coding
+	for k := 0; k < len(v.Ref); k++ {
+		if j, ok := a.index[v.Pos+k]; ok && a.gseq[j] != v.Ref[k] {
+			return nil, fmt.Errorf("%s: reference allele does not match the genome (%c at %d)", v, a.gseq[j], v.Pos+k)
+		}
+	}
+
+	// remove any shared anchor bases
+	ref, alt, pos := v.Ref, v.Alt, v.Pos
+	for len(ref) > 0 && len(alt) > 0 && ref[0] == alt[0] {
+		ref, alt, pos = ref[1:], alt[1:], pos+1
+	}
+	for len(ref) > 0 && len(alt) > 0 && ref[len(ref)-1] == alt[len(alt)-1] {
+		ref, alt = ref[:len(ref)-1], alt[:len(alt)-1]
+	}
+	if ref == "" && alt == "" {
+		return nil, fmt.Errorf("%s: reference and alternate alleles are the same", v)
+	}
+
+	// find the (contiguous) coding offset of the affected bases
+	i0, ok := a.index[pos]
+	if ref == "" {
+		// insertion between pos-1 and pos
+		prev, ok2 := a.index[pos-1]
+		if !ok || !ok2 {
+			return nil, ErrNotCoding
+		}
+		if prev != i0-1 {
+			return nil, fmt.Errorf("%s: insertion is at an exon boundary", v)
+		}
+	} else {
+		covered := 0
+		for k := 0; k < len(ref); k++ {
+			if _, in := a.index[pos+k]; in {
+				covered++
+			}
+		}
+		if covered == 0 {
+			return nil, ErrNotCoding
+		}
+		if covered < len(ref) || a.index[pos+len(ref)-1] != i0+len(ref)-1 {
+			return nil, fmt.Errorf("%s: variant spans an exon boundary", v)
+		}
+		if a.gseq[i0:i0+len(ref)] != ref {
+			return nil, fmt.Errorf("%s: reference allele does not match the genome (%s)", v, a.gseq[i0:i0+len(ref)])
+		}
+	}
+
+	// first coding base affected, in the transcript's orientation and
+	// counted from the first complete codon
+	c0 := i0
+	if a.t.Strand == '-' {
+		c0 = len(a.gseq) - i0 - len(ref)
+	}
+	c0 -= a.t.Phase
+	if c0 < 0 {
+		return nil, fmt.Errorf("%s: variant is in the incomplete first codon", v)
+	}
+
+	mutated := a.gseq[:i0] + alt + a.gseq[i0+len(ref):]
+	refP := a.protein
+	altP := a.translate(mutated)
+
+	i := 0
+	for i < len(refP) && i < len(altP) && refP[i] == altP[i] {
+		i++
+	}
+	if i >= len(refP) {
+		i = len(refP) - 1
+	}
+	ch := &Change{Variant: v, Pos: i + 1}
+	diff := len(alt) - len(ref)
+	switch {
+	case diff == 0 && refP == altP:
+		i = c0 / 3
+		if i >= len(refP) {
+			i = len(refP) - 1
+		}
+		ch.Pos = i + 1
+		ch.Class = Synonymous
+		ch.Label = fmt.Sprintf("%c%d%c", aaLetter(refP[i]), i+1, aaLetter(refP[i]))
+	case i == 0 && refP[0] == 'M':
+		ch.Class = StartLost
+		ch.Label = fmt.Sprintf("M1%c", aaLetter(aaAt(altP, 0)))
+	case diff%3 != 0:
+		ch.Class = Frameshift
+		ch.Label = fmt.Sprintf("%c%dfs", aaLetter(refP[i]), i+1)
+	case refP[i] == '*':
+		ch.Class = StopLost
+		ch.Label = fmt.Sprintf("X%d%cext", i+1, aaLetter(aaAt(altP, i)))
+	case aaAt(altP, i) == '*':
+		ch.Class = Nonsense
+		ch.Label = fmt.Sprintf("%c%dX", aaLetter(refP[i]), i+1)
+	case diff == 0:
+		ch.Class = Missense
+		ch.Label = fmt.Sprintf("%c%d%c", aaLetter(refP[i]), i+1, aaLetter(altP[i]))
+	case ref == "":
+		ch.Class = InframeInsertion
+		ch.Label = fmt.Sprintf("%c%dins%s", aaLetter(refP[i]), i+1, aaRange(altP, i, i+diff/3))
+	case alt == "":
+		ch.Class = InframeDeletion
+		ch.Label = fmt.Sprintf("%c%ddel", aaLetter(refP[i]), i+1)
+	default:
+		ch.Class = InframeIndel
+		ch.Label = fmt.Sprintf("%c%ddelins", aaLetter(refP[i]), i+1)
+	}
+	return ch, nil
+}
+
+// aaLetter writes stop codons as 'X', as in the lollipops change format.
+func aaLetter(aa byte) byte {
+	if aa == '*' {
+		return 'X'
+	}
+	return aa
+}
+
+func aaAt(p string, i int) byte {
+	if i < len(p) {
+		return p[i]
+	}
+	return 'X'
+}
+
+func aaRange(p string, i, j int) string {
+	if j > len(p) {
+		j = len(p)
+	}
+	if i >= j {
+		return ""
+	}
+	return strings.Replace(p[i:j], "*", "X", -1)
+}
@@ -0,0 +1,220 @@
+//
+//    Lollipops diagram generation framework for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package genome
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// The test transcript is on the minus strand with two coding exons, and
+// codes for MKWRD* as ATGAAAT|GGCGCGATTAA, so that the W3 codon is split
+// by the intron. On the forward strand the exons are at 41-47 (ATTTCAT)
+// and 11-21 (TTAATCGCGCC).
+const (
+	testGTF = "chr1\ttest\tCDS\t41\t47\t.\t-\t0\tgene_id \"G1\"; transcript_id \"T1.2\"; gene_name \"GENE1\";\n" +
+		"chr1\ttest\tCDS\t11\t21\t.\t-\t2\tgene_id \"G1\"; transcript_id \"T1.2\"; gene_name \"GENE1\";\n"
+	testFASTA = ">chr1 test\n" +
+		"CCCCCCCCCCTTAATCGCGCCGTAAGTTTTTT\n" +
+		"TTTTCCAGATTTCATGGGGGGGGGGGGG\n"
+)
+
+// writeTestFiles writes the annotation and genome to a temporary directory,
+// returning the annotation's path and the opened genome.
+func writeTestFiles(t *testing.T, gtfData, fastaData string) (string, *FASTA) {
+	dir := t.TempDir()
+	gtf := filepath.Join(dir, "test.gtf")
+	fasta := filepath.Join(dir, "test.fa")
+	if err := os.WriteFile(gtf, []byte(gtfData), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fasta, []byte(fastaData), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ref, err := OpenFASTA(fasta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ref.Close() })
+	return gtf, ref
+}
+
+func testAnnotator(t *testing.T) *Annotator {
+	gtf, ref := writeTestFiles(t, testGTF, testFASTA)
+	tr, err := LoadTranscript(gtf, "GENE1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.ID != "T1.2" || tr.Strand != '-' || len(tr.CDS) != 2 {
+		t.Fatalf("unexpected transcript %+v", tr)
+	}
+
+	a, err := NewAnnotator(tr, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Protein() != "MKWRD*" {
+		t.Fatalf("protein is %s, expected MKWRD*", a.Protein())
+	}
+	return a
+}
+
+func TestAnnotate(t *testing.T) {
+	a := testAnnotator(t)
+	for _, c := range []struct {
+		variant string
+		label   string
+		class   string
+	}{
+		{"chr1:44 T>C", "K2E", Missense},
+		{"1:41 A>G", "W3R", Missense},    // first base of the split codon
+		{"chr1:20 C>T", "W3X", Nonsense}, // last base, across the intron
+		{"chr1:17 G>A", "R4R", Synonymous},
+		{"chr1:46 A>G", "M1T", StartLost},
+		{"chr1:11 T>G", "X6Yext", StopLost},
+		{"chr1:42 TT>T", "K2fs", Frameshift},
+		{"chr1:42 T>TCCC", "W3insG", InframeInsertion},
+		{"chr1:16 CGCG>C", "R4del", InframeDeletion},
+	} {
+		v, err := ParseVariant(c.variant)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ch, err := a.Annotate(v)
+		if err != nil {
+			t.Errorf("%s: %s", c.variant, err)
+			continue
+		}
+		if ch.Label != c.label || ch.Class != c.class {
+			t.Errorf("%s: got %s (%s), expected %s (%s)", c.variant, ch.Label, ch.Class, c.label, c.class)
+		}
+	}
+}
+
+func TestAnnotateErrors(t *testing.T) {
+	a := testAnnotator(t)
+	for _, c := range []struct {
+		variant string
+		reason  string
+	}{
+		{"chr1:30 T>C", "intronic"},
+		{"chr2:44 T>C", "other chromosome"},
+		{"chr1:21 CG>C", "deletion of the intron's first base"},
+		{"chr1:47 T>TA", "insertion after the last coding base"},
+		{"chr1:44 G>C", "reference mismatch"},
+		{"chr1:42 A>ACCC", "insertion anchor mismatch"},
+		{"chr1:42 AT>A", "deletion anchor mismatch"},
+	} {
+		v, err := ParseVariant(c.variant)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ch, err := a.Annotate(v); err == nil {
+			t.Errorf("%s (%s): expected an error, got %s", c.variant, c.reason, ch.Label)
+		}
+	}
+}
+
+// The Ensembl test annotation is laid out as Ensembl writes its GTF files,
+// with the stop codon only in a stop_codon feature. ENST02 codes for MKWRD*
+// on the + strand as ATGAAAT|GGCGCGAT|TAA at 3-9, 24-31 and 32-34. ENST03
+// has an incomplete 5' end, starting at 4 with phase 2, and codes for KWRD*.
+const (
+	ensemblAttrs = "gene_id \"ENSG02\"; gene_version \"1\"; gene_name \"GENE2\"; gene_source \"ensembl\"; gene_biotype \"protein_coding\";"
+	ensemblGTF   = "#!genome-build test\n" +
+		"chr2\tensembl\tgene\t1\t38\t.\t+\t.\t" + ensemblAttrs + "\n" +
+		"chr2\tensembl\ttranscript\t1\t38\t.\t+\t.\t" + ensemblAttrs + " transcript_id \"ENST02\"; transcript_version \"3\"; tag \"basic\";\n" +
+		"chr2\tensembl\texon\t1\t9\t.\t+\t.\t" + ensemblAttrs + " transcript_id \"ENST02\"; transcript_version \"3\"; exon_number \"1\";\n" +
+		"chr2\tensembl\tCDS\t3\t9\t.\t+\t0\t" + ensemblAttrs + " transcript_id \"ENST02\"; transcript_version \"3\"; exon_number \"1\";\n" +
+		"chr2\tensembl\tstart_codon\t3\t5\t.\t+\t0\t" + ensemblAttrs + " transcript_id \"ENST02\"; transcript_version \"3\"; exon_number \"1\";\n" +
+		"chr2\tensembl\texon\t24\t38\t.\t+\t.\t" + ensemblAttrs + " transcript_id \"ENST02\"; transcript_version \"3\"; exon_number \"2\";\n" +
+		"chr2\tensembl\tCDS\t24\t31\t.\t+\t2\t" + ensemblAttrs + " transcript_id \"ENST02\"; transcript_version \"3\"; exon_number \"2\";\n" +
+		"chr2\tensembl\tstop_codon\t32\t34\t.\t+\t0\t" + ensemblAttrs + " transcript_id \"ENST02\"; transcript_version \"3\"; exon_number \"2\";\n" +
+		"chr2\tensembl\tfive_prime_utr\t1\t2\t.\t+\t.\t" + ensemblAttrs + " transcript_id \"ENST02\"; transcript_version \"3\";\n" +
+		"chr2\tensembl\tthree_prime_utr\t35\t38\t.\t+\t.\t" + ensemblAttrs + " transcript_id \"ENST02\"; transcript_version \"3\";\n" +
+		"chr2\tensembl\ttranscript\t4\t38\t.\t+\t.\t" + ensemblAttrs + " transcript_id \"ENST03\"; transcript_version \"1\"; tag \"cds_start_NF\";\n" +
+		"chr2\tensembl\texon\t4\t9\t.\t+\t.\t" + ensemblAttrs + " transcript_id \"ENST03\"; transcript_version \"1\"; exon_number \"1\";\n" +
+		"chr2\tensembl\tCDS\t4\t9\t.\t+\t2\t" + ensemblAttrs + " transcript_id \"ENST03\"; transcript_version \"1\"; exon_number \"1\";\n" +
+		"chr2\tensembl\texon\t24\t38\t.\t+\t.\t" + ensemblAttrs + " transcript_id \"ENST03\"; transcript_version \"1\"; exon_number \"2\";\n" +
+		"chr2\tensembl\tCDS\t24\t31\t.\t+\t2\t" + ensemblAttrs + " transcript_id \"ENST03\"; transcript_version \"1\"; exon_number \"2\";\n" +
+		"chr2\tensembl\tstop_codon\t32\t34\t.\t+\t0\t" + ensemblAttrs + " transcript_id \"ENST03\"; transcript_version \"1\"; exon_number \"2\";\n"
+	ensemblFASTA = ">chr2 test\n" +
+		"GGATGAAATGTAAGTTTTTTCAGGGCGCGATTAACCCC\n"
+)
+
+func TestAnnotateEnsembl(t *testing.T) {
+	gtf, ref := writeTestFiles(t, ensemblGTF, ensemblFASTA)
+	for _, c := range []struct {
+		name    string
+		id      string
+		cds     [][2]int
+		phase   int
+		protein string
+		changes map[string]string // variant => label, or "" for an error
+	}{
+		{"GENE2", "ENST02", [][2]int{{3, 9}, {24, 34}}, 0, "MKWRD*", map[string]string{
+			"chr2:9 T>A":  "W3R",
+			"chr2:30 A>T": "D5V",
+			"chr2:32 T>C": "X6Qext",
+			"chr2:33 A>C": "X6Sext",
+			"chr2:34 A>G": "X6X",
+			"chr2:35 C>T": "",
+		}},
+		{"ENST03", "ENST03", [][2]int{{4, 9}, {24, 34}}, 2, "KWRD*", map[string]string{
+			"chr2:6 A>G":  "K1E",
+			"chr2:9 T>A":  "W2R",
+			"chr2:33 A>C": "X5Sext",
+			"chr2:5 G>A":  "", // in the incomplete first codon
+		}},
+	} {
+		tr, err := LoadTranscript(gtf, c.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tr.ID != c.id || tr.Phase != c.phase || !reflect.DeepEqual(tr.CDS, c.cds) {
+			t.Errorf("%s: got %s with CDS %v and phase %d, expected %s with CDS %v and phase %d",
+				c.name, tr.ID, tr.CDS, tr.Phase, c.id, c.cds, c.phase)
+			continue
+		}
+		a, err := NewAnnotator(tr, ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a.Protein() != c.protein {
+			t.Errorf("%s: protein is %s, expected %s", c.id, a.Protein(), c.protein)
+			continue
+		}
+		for variant, label := range c.changes {
+			v, err := ParseVariant(variant)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ch, err := a.Annotate(v)
+			switch {
+			case label == "" && err == nil:
+				t.Errorf("%s %s: expected an error, got %s", c.id, variant, ch.Label)
+			case label != "" && err != nil:
+				t.Errorf("%s %s: %s", c.id, variant, err)
+			case label != "" && ch.Label != label:
+				t.Errorf("%s %s: got %s, expected %s", c.id, variant, ch.Label, label)
+			}
+		}
+	}
+}
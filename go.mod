@@ -7,4 +7,8 @@ require (
 	golang.org/x/image v0.0.0-20220617043117-41969df76e82
 )
 
-require github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0
+require (
+	github.com/BurntSushi/toml v1.3.2
+	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0
+	gopkg.in/yaml.v3 v3.0.1
+)
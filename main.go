@@ -21,43 +21,164 @@
 package main
 
 import (
+	"bufio"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
 	"path"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/inconshreveable/mousetrap"
+	"github.com/joiningdata/lollipops/analysis"
 	"github.com/joiningdata/lollipops/data"
 	"github.com/joiningdata/lollipops/drawing"
+	"github.com/joiningdata/lollipops/genome"
 )
 
 var (
 	queryDB = flag.String("Q", "GENENAME", "Uniprot query database when -U not used")
 	uniprot = flag.String("U", "", "Uniprot accession instead of GENE_SYMBOL")
 	domains = flag.String("D", "pfam", "source of protein domains (defaults to pfam)")
-	output  = flag.String("o", "", "output SVG/PNG file (default GENE_SYMBOL.svg)")
+	tracks  = flag.String("tracks", "", "comma-separated UniProt feature tracks to draw (ss, ptm, sites)")
+	output  = flag.String("o", "", "output SVG/PNG/HTML file (default GENE_SYMBOL.svg)")
 	width   = flag.Int("w", 0, "output width (default automatic fit labels)")
 	dpi     = flag.Float64("dpi", 72, "output DPI for PNG rasterization")
 
+	interactive = flag.Bool("interactive", false, "choose between the UniProt entries matching GENE_SYMBOL")
+	pick        = flag.Int("pick", 0, "use the Nth ranked UniProt entry matching GENE_SYMBOL")
+
+	hotspotsPath = flag.String("hotspots", "", "test for variant hotspots, highlight them and write them to this TSV file")
+	hotspotQ     = flag.Float64("hotspot-q", 0.05, "false discovery rate threshold for -hotspots")
+	summaryPath  = flag.String("summary", "", "write a per-domain variant enrichment summary to this TSV file")
+
+	gtfPath      = flag.String("gtf", "", "GTF/GFF3 gene annotation, to give changes as genomic variants")
+	fastaPath    = flag.String("fasta", "", "reference genome FASTA for -gtf")
+	transcriptID = flag.String("transcript", "", "transcript ID for -gtf (default: longest coding transcript of GENE_SYMBOL)")
+
+	mafPath      = flag.String("maf", "", "read GENE_SYMBOL's mutations from a cBioPortal data_mutations file or GDC MAF")
+	mafGroup     = flag.String("maf-group", "", "color -maf mutations by this MAF column or -clinical attribute")
+	clinicalPath = flag.String("clinical", "", "cBioPortal or GDC clinical file with the -maf-group attribute")
+
+	uniprotFile  = flag.String("uniprot-file", "", "read UniProt entries from this local .dat or .xml file instead of rest.uniprot.org")
+	uniprotIndex = flag.Bool("uniprot-index", false, "save the -uniprot-file index to FILE.idx for later runs")
+
+	domainFile   = flag.String("domain-file", "", "read domains from an InterProScan TSV/GFF3 or hmmscan --domtblout file instead of InterPro")
+	proteinFasta = flag.String("protein-fasta", "", "protein FASTA giving the sequence length for -domain-file")
+	maxEValue    = flag.Float64("evalue", 0.01, "E-value threshold for -domain-file hits")
+	keepOverlaps = flag.Bool("keep-overlaps", false, "keep overlapping -domain-file hits instead of only the best one")
+
+	batchPath      = flag.String("batch", "", "draw every diagram listed in this tab-separated manifest file")
+	batchWorkers   = flag.Int("batch-workers", 4, "number of diagrams to draw at once with -batch")
+	batchCacheSize = flag.Int("batch-cache-size", 1000, "number of remote API responses to cache with -batch (0 disables)")
+
 	showLegend     = flag.Bool("legend", false, "draw a legend for colored regions")
 	showLabels     = flag.Bool("labels", false, "draw mutation labels above lollipops")
+	showTitle      = flag.Bool("title", false, "draw a title line with the gene, protein and organism")
+	titleText      = flag.String("title-text", "", "custom text for the -title line")
+	showDensity    = flag.Bool("density", false, "draw a mutation density track and shade dense regions")
+	labelMinCount  = flag.Int("label-min-count", 0, "only label lollipops with at least this count")
+	labelTop       = flag.Int("label-top", 0, "only label the N lollipops with the highest counts")
 	showDisordered = flag.Bool("show-disordered", false, "draw disordered regions on the backbone")
 	showMotifs     = flag.Bool("show-motifs", false, "draw simple motif regions")
 	hideAxis       = flag.Bool("hide-axis", false, "do not draw the aa position axis")
 	noPatterns     = flag.Bool("no-patterns", false, "use solid fill instead of patterns for SVG output")
+	useStylesheet  = flag.Bool("css", false, "use a <style> block instead of inline styles in SVG output")
+	embedFont      = flag.Bool("embed-font", false, "embed the font used for layout in SVG output")
 	domainLabels   = flag.String("domain-labels", "truncated", "how to apply domain labels")
+	domainLayout   = flag.String("domain-layout", "overlap", "how to draw overlapping domains")
 
 	synColor = flag.String("syn-color", "#0000ff", "color to use for synonymous lollipops")
 	mutColor = flag.String("mut-color", "#ff0000", "color to use for non-synonymous lollipops")
 
-	fontPath = flag.String("f", "", "Path to truetype font to use for drawing (defaults to Arial.ttf)")
+	customTracks trackFlags
+
+	fontPath = flag.String("f", "", "Path to truetype font to use for drawing (defaults to Arial if installed, otherwise a bundled font), or a comma-separated fallback list")
+
+	configPath   = flag.String("config", "", "JSON, YAML or TOML file of drawing settings")
+	domainColors = flag.String("domain-colors", "", "file of domain accession to #RRGGBB color mappings")
+	theme        = flag.String("theme", "", "named color theme (default, okabe-ito, viridis, grayscale, dark)")
 )
 
+// uniprotEntries are the UniProt entries read from -uniprot-file, if given.
+var uniprotEntries *data.UniProtFile
+
+func init() {
+	flag.Var(&customTracks, "track", "custom annotation track as NAME=FILE.tsv (may be repeated)")
+}
+
+// trackFlags collects the NAME=FILE values of repeated -track flags.
+type trackFlags []string
+
+func (t *trackFlags) String() string { return strings.Join(*t, ",") }
+func (t *trackFlags) Set(v string) error {
+	if !strings.Contains(v, "=") {
+		return fmt.Errorf("expected NAME=FILE")
+	}
+	*t = append(*t, v)
+	return nil
+}
+
+// flagSettings copies each drawing-related flag value into the default settings.
+var flagSettings = map[string]func(){
+	"legend":          func() { drawing.DefaultSettings.ShowLegend = *showLegend },
+	"labels":          func() { drawing.DefaultSettings.ShowLabels = *showLabels },
+	"title":           func() { drawing.DefaultSettings.ShowTitle = *showTitle },
+	"title-text":      func() { drawing.DefaultSettings.Title = *titleText },
+	"density":         func() { drawing.DefaultSettings.ShowDensity = *showDensity },
+	"label-min-count": func() { drawing.DefaultSettings.LabelMinCount = *labelMinCount },
+	"label-top":       func() { drawing.DefaultSettings.LabelTop = *labelTop },
+	"show-disordered": func() { drawing.DefaultSettings.HideDisordered = !*showDisordered },
+	"show-motifs":     func() { drawing.DefaultSettings.HideMotifs = !*showMotifs },
+	"hide-axis":       func() { drawing.DefaultSettings.HideAxis = *hideAxis },
+	"no-patterns":     func() { drawing.DefaultSettings.SolidFillOnly = *noPatterns },
+	"css":             func() { drawing.DefaultSettings.UseStylesheet = *useStylesheet },
+	"embed-font":      func() { drawing.DefaultSettings.EmbedFont = *embedFont },
+	"domain-labels":   func() { drawing.DefaultSettings.DomainLabelStyle = *domainLabels },
+	"domain-layout":   func() { drawing.DefaultSettings.DomainLayout = *domainLayout },
+	"syn-color":       func() { drawing.DefaultSettings.SynonymousColor = *synColor },
+	"mut-color":       func() { drawing.DefaultSettings.MutationColor = *mutColor },
+	"w":               func() { drawing.DefaultSettings.GraphicWidth = float64(*width) },
+}
+
+// applySettings sets the default drawing settings from the flag defaults,
+// then the -config file, then the flags given on the command line (named in
+// given), so that -theme and the other flags take precedence over the file.
+func applySettings(given map[string]bool) error {
+	for _, apply := range flagSettings {
+		apply()
+	}
+	if *configPath != "" {
+		if err := drawing.DefaultSettings.LoadConfig(*configPath); err != nil {
+			return err
+		}
+	}
+	if *theme != "" {
+		if err := drawing.DefaultSettings.ApplyTheme(*theme); err != nil {
+			return err
+		}
+	}
+	// the colors given as flags override the theme's
+	for name := range given {
+		if apply, ok := flagSettings[name]; ok {
+			apply()
+		}
+	}
+	return nil
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "serve" {
+		runServer(os.Args[2:])
+		return
+	}
+
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: %s [options] {-Q UNIPROT_DB IDENTIFER | -U UNIPROT_ID | GENE_SYMBOL} [PROTEIN CHANGES ...]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "       %s serve [-addr :8080] [-timeout 60s] [-cache-size 1000] [-f a.ttf,b.ttf] [-uniprot-file sprot.dat [-uniprot-index]]\n", os.Args[0])
 		fmt.Fprint(os.Stderr, `
 Protein ID input:
   GENE_SYMBOL is the official human HGNC gene symbol. This will use the
@@ -65,6 +186,13 @@ Protein ID input:
 
   You can provide a UniProt ID directly with -U (e.g. "-U P04637" for TP53)
 
+  If several UniProt entries match GENE_SYMBOL, reviewed (Swiss-Prot) entries
+  are preferred over unreviewed ones, and then entries whose primary gene
+  name matches over those where it is a synonym. Use -interactive to choose from
+  the ranked list, or -pick=N to use the Nth entry in the list. If no reviewed
+  entry matches, an unreviewed (TrEMBL) entry must be chosen this way or
+  with -U.
+
   For more advanced usage, query UniprotKB's database mappings directly using
   a supported identifier with -Q DBNAME. Available DBNAMEs can be found here:
      http://www.uniprot.org/help/programmatic_access#id_mapping_examples
@@ -93,65 +221,224 @@ Protein changes:
 
   (N.B. color must come before count in tags)
 
+Genomic variants:
+  -gtf=genes.gtf          give PROTEIN CHANGES as genomic variants instead, and
+                          convert them using this GTF or GFF3 gene annotation
+  -fasta=genome.fa        reference genome for -gtf (uses a .fai index if present)
+  -transcript=ENST00000269305
+                          transcript to use (default = the transcript with the
+                          longest coding sequence for GENE_SYMBOL)
+
+  Genomic variants are given as CHROM:POS REF>ALT (e.g. "chr17:7673802 C>T"),
+  CHROM:POS:REF:ALT or CHROM-POS-REF-ALT, and may include the #COLOR and @COUNT
+  tags. SNVs and indels within a coding exon are translated into protein
+  changes such as R273C, R213X or P72fs. Other variants are skipped.
+
 Protein domains:
   -D pfam				  set the source of protein domains
 						    "pfam"     = use domains from Pfam
 							"interpro" = use domains from CDD, NCBIfam, Pfam, PROSITE, and SMART
+							"uniprot"  = use the domain, repeat and zinc finger features
+							             of the UniProt entry (no InterPro requests)
+  -uniprot-file=sprot.dat read UniProt entries from a local UniProtKB flat file
+                          or XML file (optionally bgzipped) instead of the UniProt
+                          API. GENE_SYMBOL is searched among its human entries.
+                          The file is indexed in memory on each run, unless
+                          an up to date FILE.idx exists
+  -uniprot-index          save the -uniprot-file index to FILE.idx, so later
+                          runs can skip indexing
+
+Local domains:
+  -domain-file=hits.tsv   read domains from InterProScan TSV or GFF3 output, or
+                          from hmmscan --domtblout output, instead of InterPro.
+                          GENE_SYMBOL is then the protein's sequence ID, and
+                          no network requests are made
+  -protein-fasta=seq.fa   protein FASTA giving the length and description of
+                          the protein (needed if not in the -domain-file)
+  -evalue=0.01            drop hits with a larger E-value
+  -keep-overlaps          keep every hit, instead of dropping hits that mostly
+                          overlap a hit with a better E-value
+
+  With -D pfam only Pfam hits are used from InterProScan output, and with
+  -D interpro CDD, NCBIfam, PROSITE profile and SMART hits are also used.
+  Disorder, coiled-coil, transmembrane and signal peptide predictions are
+  used as motifs.
+
+Mutation tables:
+  -maf=data_mutations.txt read GENE_SYMBOL's mutations from a cBioPortal
+                          data_mutations file or a GDC/TCGA MAF (optionally
+                          gzipped), in addition to any PROTEIN CHANGES given.
+                          Calls in the same sample at the same position are
+                          counted once, and lollipops are sized by the number
+                          of samples with each change
+  -maf-group=CANCER_TYPE  color the mutations by this MAF column, or by this
+                          attribute of the -clinical file, splitting each
+                          change into one lollipop per group
+  -clinical=data_clinical_sample.txt
+                          cBioPortal clinical sample or patient file, or GDC
+                          clinical TSV, giving the -maf-group attribute of
+                          each sample
+
+Feature tracks:
+  -tracks=ss,ptm,sites    draw UniProt features as tracks below the backbone
+                            "ss"    = secondary structure (helix, strand, turn)
+                            "ptm"   = modified residues, glycosylation,
+                                      lipidation, cross-links, disulfide bonds
+                            "sites" = active, binding and other sites
+  -track=NAME=FILE.tsv    draw a custom track from a tab-separated file with
+                          start, end, label and optional #RRGGBB color columns
+                          in amino acid positions (may be repeated)
 
 Diagram generation options:
   -legend                 draw a legend for colored regions
+  -title                  draw a title line built from the UniProt entry, e.g.
+                          "TP53: Cellular tumor antigen p53 (Homo sapiens,
+                          UniProt P04637 v287)"
+  -title-text="..."       use custom text for the -title line
+  -theme=okabe-ito        set all diagram colors from a named theme
+                            "default", "okabe-ito" and "viridis" (colorblind-safe),
+                            "grayscale", or "dark"
   -syn-color="#0000ff"    color to use for synonymous mutation markers
   -mut-color="#ff0000"    color to use for non-synonymous mutation markers
   -hide-axis              do not draw the amino position x-axis
   -show-disordered        draw disordered regions on the backbone
   -show-motifs            draw simple motif regions
   -labels                 draw label text above lollipop markers
+  -label-min-count=N      only label lollipops with a count of at least N
+  -label-top=N            only label the N lollipops with the highest counts
+  -density                draw a smoothed mutation density track above the
+                          backbone and shade windows with significantly more
+                          mutations than expected (Poisson, Bonferroni p<0.05)
+  -hotspots=out.tsv       test each position for more variants than expected
+                          under a uniform background (binomial test), and
+                          clusters of nearby variants (permutation test).
+                          Significant positions are circled and clusters are
+                          shaded, and all hotspots are written to out.tsv
+                          with p-values and Benjamini-Hochberg q-values
+  -hotspot-q=0.05         false discovery rate threshold for -hotspots
+  -summary=out.tsv        write the number of variants and samples in each
+                          domain and motif (and in unannotated sequence), with
+                          the count expected from its length, fold enrichment
+                          and a one-sided binomial test p-value (of the samples
+                          falling in it, given its fraction of the residues)
   -no-patterns            use solid fill instead of patterns (SVG only)
+  -css                    put text styles and theme colors in a <style> block
+                          instead of inline styles (SVG only)
+  -embed-font             embed the font used to size labels, so that text
+                          renders identically on every machine (SVG only)
   -domain-labels=fit      hot to apply domain labels (default="truncated")
                             "fit" = only if fits in space available
                             "off" = do not draw text in the domains
+  -domain-layout=stacked  how to draw overlapping domains (default="overlap")
+                            "overlap" = draw all domains on the backbone
+                            "stacked" = move overlapping domains to extra rows
+
+Settings file:
+  -config=style.yaml      load drawing settings from a JSON, YAML or TOML file.
+                          Keys are the drawing.Settings field names (e.g.
+                          LollipopRadius, DomainHeight, AxisHeight) and
+                          DomainColors maps domain accessions or names to
+                          #RRGGBB colors. Command-line flags take precedence.
+  -domain-colors=file.txt domain colors, one "ACCESSION #RRGGBB" pair per line
 
 Output options:
-  -o=filename.png         set output filename (.png or .svg supported)
+  -o=filename.png         set output filename (.png, .svg or .html supported)
+                            .html creates an interactive report with tooltips,
+                            zoom/pan and a sortable table of variants (with
+                            their samples when read from a -maf file)
   -w=700                  set diagram pixel width (default = automatic fit)
   -dpi=300                set DPI (PNG output only)
+  -f=a.ttf,b.ttf          TrueType font(s) used to draw and size text. Glyphs
+                          missing from the first font are taken from the next.
+                          (default = Arial if installed, otherwise a bundled font)
+
+Batch mode:
+  -batch=manifest.tsv     draw one diagram per row of a tab-separated manifest,
+                          fetching shared data and loading fonts only once.
+                          The header names the columns: gene or accession,
+                          variants (inline, comma-separated), variants_file
+                          (one change per line) and output. Other columns are
+                          per-row setting overrides named after the
+                          drawing.Settings fields (e.g. ShowLabels, GraphicWidth).
+                          A relative variants_file is found next to the
+                          manifest, and no two rows may write the same output.
+                          All other options apply to every row.
+  -batch-workers=4        number of diagrams to draw at once
+  -batch-cache-size=1000  number of UniProt/InterPro responses cached and
+                          shared between rows (0 disables the cache)
 `)
 	}
 
 	flag.Parse()
-	drawing.DefaultSettings.ShowLegend = *showLegend
-	drawing.DefaultSettings.ShowLabels = *showLabels
-	drawing.DefaultSettings.HideDisordered = !*showDisordered
-	drawing.DefaultSettings.HideMotifs = !*showMotifs
-	drawing.DefaultSettings.HideAxis = *hideAxis
-	drawing.DefaultSettings.SolidFillOnly = *noPatterns
-	drawing.DefaultSettings.DomainLabelStyle = *domainLabels
-	drawing.DefaultSettings.SynonymousColor = *synColor
-	drawing.DefaultSettings.MutationColor = *mutColor
-	drawing.DefaultSettings.GraphicWidth = float64(*width)
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	if err := applySettings(given); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if *domainColors != "" {
+		colors, err := data.LoadColorMap(*domainColors)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if drawing.DefaultSettings.DomainColors == nil {
+			drawing.DefaultSettings.DomainColors = make(map[string]string)
+		}
+		for key, color := range colors {
+			drawing.DefaultSettings.DomainColors[key] = color
+		}
+	}
 	domainsDatabase := strings.ToLower(*domains)
 
 	if *fontPath == "" {
 		err := drawing.LoadDefaultFont()
 		if err != nil {
-			fmt.Fprintln(os.Stderr, "ERROR: Unable to find Arial.ttf - Which is required for accurate font sizing.")
-			fmt.Fprintln(os.Stderr, "       Please use -f=/path/to/arial.ttf or the TrueType (.ttf) font of your choice.")
-			// continue in the hopes that SVG rendering will be ok...
-			//os.Exit(1)
+			fmt.Fprintln(os.Stderr, "ERROR:", err)
+			fmt.Fprintln(os.Stderr, "       Please use -f=/path/to/font.ttf with the TrueType (.ttf) font of your choice.")
+			os.Exit(1)
 		}
-	} else {
-		fname := path.Base(*fontPath)
-		fname = strings.TrimSuffix(fname, path.Ext(fname))
-		err := drawing.LoadFont(fname, *fontPath)
+	} else if err := loadFonts(*fontPath); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if domainsDatabase != "pfam" && domainsDatabase != "interpro" && domainsDatabase != "uniprot" {
+		fmt.Fprintln(os.Stderr, "ERROR: Invalid source of protein domains (available: InterPro, Pfam, UniProt).")
+		os.Exit(1)
+	}
+
+	if *uniprotFile != "" {
+		var err error
+		uniprotEntries, err = data.OpenUniProtFile(*uniprotFile, *uniprotIndex)
 		if err != nil {
 			fmt.Fprintln(os.Stderr, err)
 			os.Exit(1)
 		}
 	}
 
-	if domainsDatabase != "pfam" && domainsDatabase != "interpro" {
-		fmt.Fprintln(os.Stderr, "ERROR: Invalid source of protein domains (available: InterPro, Pfam).")
-		os.Exit(1)
+	var trackNames []string
+	if *tracks != "" {
+		trackNames = strings.Split(*tracks, ",")
+	}
+	var extraTracks []data.GraphicTrack
+	for _, spec := range customTracks {
+		parts := strings.SplitN(spec, "=", 2)
+		track, err := data.GetLocalTrack(parts[0], parts[1])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		extraTracks = append(extraTracks, track)
+	}
+
+	if *batchPath != "" {
+		if runBatch(*batchPath, *batchWorkers, *batchCacheSize, domainsDatabase, trackNames, extraTracks) > 0 {
+			os.Exit(1)
+		}
+		return
 	}
 
 	var err error
@@ -162,9 +449,15 @@ Output options:
 		geneSymbol = flag.Arg(0)
 		varStart = 1
 
-		if *queryDB == "GENENAME" {
+		if *domainFile != "" {
+			// the protein is named in the local files, there is nothing to look up
+		} else if *queryDB == "GENENAME" {
 			fmt.Fprintln(os.Stderr, "HGNC Symbol: ", flag.Arg(0))
-			acc, err = data.GetProtID(flag.Arg(0))
+			if *interactive || *pick > 0 {
+				acc, err = pickProtID(flag.Arg(0))
+			} else {
+				acc, err = getProtID(flag.Arg(0))
+			}
 		} else {
 			fmt.Fprintln(os.Stderr, "Searching for ID: ", flag.Arg(0))
 			acc, err = data.GetProtMapping(*queryDB, flag.Arg(0))
@@ -175,7 +468,9 @@ Output options:
 			os.Exit(1)
 		}
 
-		fmt.Fprintln(os.Stderr, "Uniprot/SwissProt Accession: ", acc)
+		if acc != "" {
+			fmt.Fprintln(os.Stderr, "Uniprot/SwissProt Accession: ", acc)
+		}
 	}
 
 	if *uniprot != "" {
@@ -200,37 +495,315 @@ Press Enter/Ctrl-C to quit.`)
 		os.Exit(1)
 	}
 
-	var d *data.GraphicResponse = &data.GraphicResponse{}
-
-	length, err := data.GetProtLength(acc)
+	var d *data.GraphicResponse
+	if *domainFile != "" {
+		if len(trackNames) > 0 {
+			fmt.Fprintln(os.Stderr, "ERROR: -tracks requires a UniProt entry and cannot be used with -domain-file.")
+			os.Exit(1)
+		}
+		d, err = localGraphicData(geneSymbol, domainsDatabase)
+	} else {
+		d, err = data.GetGraphicData(context.Background(), acc, &data.FetchOptions{
+			Domains: domainsDatabase,
+			Tracks:  trackNames,
+			Entries: uniprotEntries,
+		})
+	}
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
+	d.Tracks = append(d.Tracks, extraTracks...)
+	length64, _ := d.Length.Int64()
+	length := int(length64)
+
+	changes := flag.Args()[varStart:]
+	if *gtfPath != "" {
+		name := *transcriptID
+		if name == "" {
+			name = geneSymbol
+		}
+		var protLen int
+		changes, protLen, err = genomicChanges(changes, name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		if protLen != length {
+			fmt.Fprintf(os.Stderr, "WARNING: the transcript encodes %daa but the UniProt entry is %daa, positions may not match the domains\n", protLen, length)
+		}
+	}
+
+	if *mafPath != "" {
+		gene := geneSymbol
+		if (*uniprot != "" || *queryDB != "GENENAME") && d.Metadata.GeneName != "" {
+			gene = d.Metadata.GeneName
+		}
+		more, samples, err := mafChanges(gene, length)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		changes = append(changes, more...)
+		drawing.DefaultSettings.Samples = samples
+	}
+
+	if *output == "" {
+		*output = geneSymbol + ".svg"
+	}
 
-	d.Length = json.Number(fmt.Sprint(length))
+	if *summaryPath != "" {
+		variants := analysis.ParseVariants(changes)
+		f, err := os.Create(*summaryPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		err = analysis.WriteSummaryTSV(f, analysis.SummarizeRegions(variants, d))
+		if err == nil {
+			err = f.Close()
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
+
+	if *hotspotsPath != "" {
+		opts := analysis.DefaultHotspotOptions
+		opts.MaxQ = *hotspotQ
+		variants := analysis.ParseVariants(changes)
+		hs := analysis.FindHotspots(variants, length, opts)
+		fmt.Fprintf(os.Stderr, "Found %d hotspots (q <= %g)\n", len(hs), opts.MaxQ)
+		drawing.DefaultSettings.Hotspots = hs
+
+		f, err := os.Create(*hotspotsPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		err = analysis.WriteHotspotsTSV(f, hs)
+		if err == nil {
+			err = f.Close()
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+	}
 
-	regions, err := data.GetProteinMatches(domainsDatabase, acc)
+	err = createOutput(*output, &drawing.DefaultSettings, d, changes)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
-	d.Regions = regions
+}
 
-	motifs, err := data.GetSequenceFeatures(acc)
+// loadFonts loads a comma-separated list of TrueType font files, named after
+// their files. Fonts after the first are used for glyphs missing from the
+// fonts before them.
+func loadFonts(paths string) error {
+	for i, fpath := range strings.Split(paths, ",") {
+		fname := path.Base(fpath)
+		fname = strings.TrimSuffix(fname, path.Ext(fname))
+		load := drawing.AddFallbackFont
+		if i == 0 {
+			load = drawing.LoadFont
+		}
+		if err := load(fname, fpath); err != nil {
+			return fmt.Errorf("unable to load font %s from -f=%s: %s", fpath, paths, err)
+		}
+	}
+	return nil
+}
+
+// getProtID returns the best UniProt entry for symbol, from the
+// -uniprot-file entries if given.
+func getProtID(symbol string) (string, error) {
+	if uniprotEntries != nil {
+		return uniprotEntries.GetProtID(symbol)
+	}
+	return data.GetProtID(symbol)
+}
+
+// pickProtID returns the UniProt entry for symbol chosen with -pick, or
+// prompts for a choice from the ranked candidates if -interactive is set.
+func pickProtID(symbol string) (string, error) {
+	var cands []data.ProtCandidate
+	var err error
+	if uniprotEntries != nil {
+		cands = uniprotEntries.Candidates(symbol, 9606)
+	} else {
+		cands, err = data.GetProtCandidates(symbol)
+	}
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		return "", err
+	}
+	if len(cands) == 0 {
+		return "", fmt.Errorf("unable to find protein ID for '%s'", symbol)
+	}
+	data.WriteProtCandidates(os.Stderr, cands)
+
+	n := *pick
+	if *interactive {
+		fmt.Fprintf(os.Stderr, "Select a protein [1-%d] (default 1): ", len(cands))
+		line, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+		n = 1
+		if line = strings.TrimSpace(line); line != "" {
+			n, err = strconv.Atoi(line)
+			if err != nil {
+				return "", fmt.Errorf("invalid selection '%s'", line)
+			}
+		}
 	}
-	d.Motifs = motifs
+	if n < 1 || n > len(cands) {
+		return "", fmt.Errorf("selection %d is out of range (1-%d)", n, len(cands))
+	}
+	fmt.Fprintf(os.Stderr, "Selected %d: %s\n", n, cands[n-1].Accession)
+	return cands[n-1].Accession, nil
+}
 
-	if *output == "" {
-		*output = geneSymbol + ".svg"
+// localGraphicData reads the domains of the named protein from -domain-file,
+// and its length and description from -protein-fasta if it is given.
+func localGraphicData(name, domainsDatabase string) (*data.GraphicResponse, error) {
+	d, err := data.GetLocalDomains(*domainFile, &data.LocalDomainOptions{
+		Protein:      name,
+		Domains:      domainsDatabase,
+		MaxEValue:    *maxEValue,
+		KeepOverlaps: *keepOverlaps,
+	})
+	if err != nil {
+		return nil, err
 	}
+	if *proteinFasta != "" {
+		_, desc, seq, err := data.GetLocalSequence(*proteinFasta, d.Metadata.Identifier)
+		if err != nil {
+			return nil, err
+		}
+		if d.Length != "0" && d.Length.String() != strconv.Itoa(len(seq)) {
+			fmt.Fprintf(os.Stderr, "WARNING: %s gives a length of %saa but the sequence is %daa\n", *domainFile, d.Length, len(seq))
+		}
+		d.Length = json.Number(strconv.Itoa(len(seq)))
+		d.Metadata.Description = desc
+	}
+	if d.Length == "0" {
+		return nil, fmt.Errorf("the length of '%s' is not given in %s, please provide its sequence with -protein-fasta", d.Metadata.Identifier, *domainFile)
+	}
+	fmt.Fprintf(os.Stderr, "Protein %s (%saa): %d domains from %s\n", d.Metadata.Identifier, d.Length, len(d.Regions), *domainFile)
+	return d, nil
+}
 
-	err = createOutput(*output, d, flag.Args()[varStart:])
+// mafChanges reads the mutations in gene from the -maf file, and returns
+// them as protein changes sized by their number of samples, along with the
+// samples having each change. With -maf-group, each group of samples is given
+// a color, largest group first.
+func mafChanges(gene string, length int) ([]string, map[string][]string, error) {
+	opts := analysis.MAFOptions{Gene: gene, GroupBy: *mafGroup}
+	if *clinicalPath != "" {
+		if *mafGroup == "" {
+			return nil, nil, fmt.Errorf("-clinical requires an attribute given with -maf-group")
+		}
+		var err error
+		opts.Clinical, err = analysis.ReadClinicalAttribute(*clinicalPath, *mafGroup)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	res, err := analysis.ReadMAFFile(*mafPath, opts)
 	if err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		return nil, nil, err
+	}
+	fmt.Fprintf(os.Stderr, "%s: %d %s mutations in %d samples (%d duplicate calls dropped)\n",
+		*mafPath, res.Rows-res.Duplicates, gene, res.Samples, res.Duplicates)
+
+	colors := make(map[string]string)
+	if *mafGroup != "" {
+		var groups []string
+		for g := range res.GroupSamples {
+			groups = append(groups, g)
+		}
+		sort.Slice(groups, func(i, j int) bool {
+			ni, nj := res.GroupSamples[groups[i]], res.GroupSamples[groups[j]]
+			if ni != nj {
+				return ni > nj
+			}
+			return groups[i] < groups[j]
+		})
+		palette := drawing.DefaultSettings.DomainPalette
+		if len(palette) == 0 {
+			palette = data.DomainPalette
+		}
+		for i, g := range groups {
+			colors[g] = palette[i%len(palette)]
+			fmt.Fprintf(os.Stderr, "  %s  %s (%d samples)\n", colors[g], g, res.GroupSamples[g])
+		}
+	}
+
+	var changes []string
+	samples := make(map[string][]string)
+	outside := 0
+	for _, m := range res.Mutations {
+		if m.Pos > length {
+			outside++
+		}
+		chg := m.Label + colors[m.Group]
+		samples[chg] = m.SampleIDs
+		if m.Samples > 1 {
+			chg += fmt.Sprintf("@%d", m.Samples)
+		}
+		changes = append(changes, chg)
+	}
+	if outside > 0 {
+		fmt.Fprintf(os.Stderr, "WARNING: %d mutations are beyond the %daa protein, the MAF may use another isoform\n", outside, length)
+	}
+	return changes, samples, nil
+}
+
+// genomicChanges converts genomic variants (with optional #COLOR and @COUNT
+// tags) into protein changes for the named transcript using the -gtf and
+// -fasta files, and returns them along with the length of the protein.
+// Variants outside the coding sequence are skipped.
+func genomicChanges(variants []string, name string) ([]string, int, error) {
+	if *fastaPath == "" {
+		return nil, 0, fmt.Errorf("-gtf requires a reference genome given with -fasta")
+	}
+	t, err := genome.LoadTranscript(*gtfPath, name)
+	if err != nil {
+		return nil, 0, err
+	}
+	fa, err := genome.OpenFASTA(*fastaPath)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer fa.Close()
+	a, err := genome.NewAnnotator(t, fa)
+	if err != nil {
+		return nil, 0, err
+	}
+	protLen := strings.Index(a.Protein(), "*")
+	if protLen == -1 {
+		protLen = len(a.Protein())
+	}
+	fmt.Fprintf(os.Stderr, "Transcript %s (%s, %s:%d-%d, %c strand, %daa)\n", t.ID, t.Gene, t.Chrom,
+		t.CDS[0][0], t.CDS[len(t.CDS)-1][1], t.Strand, protLen)
+
+	var res []string
+	for _, chg := range variants {
+		tags := ""
+		if i := strings.IndexAny(chg, "#@"); i != -1 {
+			chg, tags = chg[:i], chg[i:]
+		}
+		v, err := genome.ParseVariant(chg)
+		if err != nil {
+			return nil, 0, err
+		}
+		c, err := a.Annotate(v)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "  %s: skipped, %s\n", v, err)
+			continue
+		}
+		fmt.Fprintf(os.Stderr, "  %s -> %s (%s)\n", v, c.Label, c.Class)
+		res = append(res, c.Label+tags)
 	}
+	return res, protLen, nil
 }
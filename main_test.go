@@ -0,0 +1,74 @@
+//
+//    Lollipops command-line diagram generator for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/joiningdata/lollipops/drawing"
+)
+
+// TestSettingsPrecedence checks that the config file overrides the flag
+// defaults, and that -theme and the other flags given override the file.
+func TestSettingsPrecedence(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "style.json")
+	err := os.WriteFile(config, []byte(`{"SynonymousColor": "#111111", "MutationColor": "#222222", "ShowLabels": true}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := drawing.DefaultSettings
+	defer func() { drawing.DefaultSettings = saved }()
+
+	for _, c := range []struct {
+		flags      map[string]string
+		syn, mut   string
+		showLabels bool
+	}{
+		{map[string]string{}, "#0000ff", "#ff0000", false},
+		{map[string]string{"config": config}, "#111111", "#222222", true},
+		{map[string]string{"config": config, "theme": "okabe-ito"}, "#0072B2", "#D55E00", true},
+		{map[string]string{"theme": "okabe-ito", "config": config, "syn-color": "#333333"}, "#333333", "#D55E00", true},
+		{map[string]string{"config": config, "labels": "false", "mut-color": "#444444"}, "#111111", "#444444", false},
+	} {
+		drawing.DefaultSettings = *saved.Clone()
+		given := make(map[string]bool)
+		for name, value := range c.flags {
+			if err := flag.Set(name, value); err != nil {
+				t.Fatal(err)
+			}
+			given[name] = true
+		}
+		err := applySettings(given)
+		// reset the flags for the next case
+		for name := range c.flags {
+			flag.Set(name, flag.Lookup(name).DefValue)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		s := drawing.DefaultSettings
+		if s.SynonymousColor != c.syn || s.MutationColor != c.mut || s.ShowLabels != c.showLabels {
+			t.Errorf("%v: got %s %s %v, expected %s %s %v", c.flags, s.SynonymousColor, s.MutationColor,
+				s.ShowLabels, c.syn, c.mut, c.showLabels)
+		}
+	}
+}
@@ -11,7 +11,7 @@ import (
 	"github.com/joiningdata/lollipops/drawing"
 )
 
-func createOutput(filename string, d *data.GraphicResponse, variants []string) error {
+func createOutput(filename string, s *drawing.Settings, d *data.GraphicResponse, variants []string) error {
 	f, err := os.Create(filename)
 	if err != nil {
 		return err
@@ -19,9 +19,15 @@ func createOutput(filename string, d *data.GraphicResponse, variants []string) e
 
 	fmt.Fprintln(os.Stderr, "Drawing diagram to", filename)
 	if strings.HasSuffix(strings.ToLower(filename), ".png") {
-		drawing.DrawPNG(f, *dpi, variants, d)
+		err = s.DrawPNG(f, *dpi, variants, d)
+	} else if strings.HasSuffix(strings.ToLower(filename), ".html") {
+		err = s.DrawHTML(f, variants, d)
 	} else {
-		drawing.DrawSVG(f, variants, d)
+		err = s.DrawSVG(f, variants, d)
+	}
+	if err != nil {
+		f.Close()
+		return err
 	}
 	return f.Close()
 }
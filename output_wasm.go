@@ -12,11 +12,18 @@ import (
 	"github.com/joiningdata/lollipops/drawing"
 )
 
-func createOutput(elementID string, d *data.GraphicResponse, variants []string) error {
+func createOutput(elementID string, s *drawing.Settings, d *data.GraphicResponse, variants []string) error {
 	fmt.Fprintln(os.Stderr, "Creating SVG image")
 	buf := &bytes.Buffer{}
-	drawing.DrawSVG(buf, variants, d)
+	if err := s.DrawSVG(buf, variants, d); err != nil {
+		return err
+	}
 	js.Global().Get("document").Call("getElementById", "lollipops-svg-container").Set("innerHTML", buf.String())
 
 	return nil
 }
+
+func runServer(args []string) {
+	fmt.Fprintln(os.Stderr, "serve is not available in the browser")
+	os.Exit(1)
+}
@@ -0,0 +1,311 @@
+//go:build !wasm
+// +build !wasm
+
+//
+//    Lollipops command-line diagram generator for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/joiningdata/lollipops/data"
+	"github.com/joiningdata/lollipops/drawing"
+)
+
+// renderRequest is the JSON body of a POST /render request.
+type renderRequest struct {
+	// Gene is a gene symbol (or an identifier in QueryDB) to look up,
+	// unless Accession is given.
+	Gene      string `json:"gene"`
+	QueryDB   string `json:"query_db"`
+	Accession string `json:"accession"`
+
+	Variants []string `json:"variants"`
+	// Domains is the source of protein domains, "pfam" (default), "interpro"
+	// or "uniprot".
+	Domains string   `json:"domains"`
+	Tracks  []string `json:"tracks"`
+
+	// Settings overrides drawing settings by field name, as in a -config file.
+	Settings map[string]interface{} `json:"settings"`
+	Theme    string                 `json:"theme"`
+
+	// Format is "svg" (default), "png" or "json" (the diagram layout).
+	Format string  `json:"format"`
+	DPI    float64 `json:"dpi"`
+}
+
+// Limits on render requests, so that a single request cannot use up the
+// server's memory or CPU time.
+const (
+	maxRenderWidth    = 10000
+	maxRenderSize     = 1000
+	maxRenderDPI      = 600
+	maxRenderVariants = 10000
+)
+
+// checkLimits returns an error if the requested diagram size is out of range.
+func checkLimits(s *drawing.Settings, dpi float64, nvariants int) error {
+	if dpi < 0 || dpi > maxRenderDPI {
+		return fmt.Errorf("dpi must be between 0 and %d", maxRenderDPI)
+	}
+	if s.GraphicWidth < 0 || s.GraphicWidth > maxRenderWidth {
+		return fmt.Errorf("GraphicWidth must be between 1 and %d", maxRenderWidth)
+	}
+	if nvariants > maxRenderVariants {
+		return fmt.Errorf("at most %d variants can be drawn", maxRenderVariants)
+	}
+	sizes := []struct {
+		name string
+		v    float64
+	}{
+		{"LollipopRadius", s.LollipopRadius},
+		{"LollipopHeight", s.LollipopHeight},
+		{"BackboneHeight", s.BackboneHeight},
+		{"MotifHeight", s.MotifHeight},
+		{"DomainHeight", s.DomainHeight},
+		{"DomainRowPadding", s.DomainRowPadding},
+		{"DensityHeight", s.DensityHeight},
+		{"TrackHeight", s.TrackHeight},
+		{"TrackPadding", s.TrackPadding},
+		{"Padding", s.Padding},
+		{"AxisPadding", s.AxisPadding},
+		{"AxisHeight", s.AxisHeight},
+		{"TextPadding", s.TextPadding},
+		{"GraphicHeight", s.GraphicHeight},
+	}
+	for _, sz := range sizes {
+		if sz.v < 0 || sz.v > maxRenderSize {
+			return fmt.Errorf("%s must be between 0 and %d", sz.name, maxRenderSize)
+		}
+	}
+	// a bandwidth <= 0 is chosen automatically
+	if s.DensityBandwidth > maxRenderSize {
+		return fmt.Errorf("DensityBandwidth must be at most %d", maxRenderSize)
+	}
+	return nil
+}
+
+// serverMetrics are the counters reported by /metrics.
+type serverMetrics struct {
+	requests     int64
+	errors       int64
+	renderMicros int64
+}
+
+func runServer(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", ":8080", "address to listen on")
+	timeout := fs.Duration("timeout", 60*time.Second, "maximum time to handle a render request")
+	cacheSize := fs.Int("cache-size", 1000, "number of remote API responses to cache (0 disables)")
+	fontPath := fs.String("f", "", "Path to truetype font to use for drawing (defaults to Arial if installed, otherwise a bundled font), or a comma-separated fallback list")
+	entriesPath := fs.String("uniprot-file", "", "read UniProt entries from this local .dat or .xml file")
+	saveIndex := fs.Bool("uniprot-index", false, "save the -uniprot-file index to FILE.idx for later runs")
+	fs.Parse(args)
+
+	if *fontPath == "" {
+		err := drawing.LoadDefaultFont()
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else if err := loadFonts(*fontPath); err != nil {
+		log.Fatal(err)
+	}
+	data.SetCacheSize(*cacheSize)
+	if *entriesPath != "" {
+		var err error
+		uniprotEntries, err = data.OpenUniProtFile(*entriesPath, *saveIndex)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	m := &serverMetrics{}
+	mux := http.NewServeMux()
+	mux.Handle("/render", http.TimeoutHandler(m.handleRender(), *timeout, "render timed out\n"))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/metrics", m.handleMetrics)
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       *timeout,
+		WriteTimeout:      *timeout + 5*time.Second,
+	}
+	log.Printf("Listening on %s", *addr)
+	if err := srv.ListenAndServe(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func (m *serverMetrics) handleRender() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+			return
+		}
+		atomic.AddInt64(&m.requests, 1)
+		start := time.Now()
+		defer func() {
+			atomic.AddInt64(&m.renderMicros, time.Since(start).Microseconds())
+		}()
+
+		status, err := render(w, r)
+		if err != nil {
+			atomic.AddInt64(&m.errors, 1)
+			log.Printf("render: %s", err)
+			http.Error(w, err.Error(), status)
+		}
+	})
+}
+
+// render handles a single render request, returning the HTTP status to use
+// if it fails.
+func render(w http.ResponseWriter, r *http.Request) (int, error) {
+	req := &renderRequest{}
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(req); err != nil {
+		return http.StatusBadRequest, fmt.Errorf("invalid request: %s", err)
+	}
+
+	// each request draws with its own copy of the settings
+	s := drawing.DefaultSettings.Clone()
+	if req.Theme != "" {
+		if err := s.ApplyTheme(req.Theme); err != nil {
+			return http.StatusBadRequest, err
+		}
+	}
+	if req.Settings != nil {
+		if err := s.ApplyConfig(req.Settings); err != nil {
+			return http.StatusBadRequest, err
+		}
+		// leave GraphicWidth out for an automatic width
+		if _, ok := req.Settings["GraphicWidth"]; ok && s.GraphicWidth <= 0 {
+			return http.StatusBadRequest, fmt.Errorf("GraphicWidth must be between 1 and %d", maxRenderWidth)
+		}
+	}
+
+	domainsDatabase := strings.ToLower(req.Domains)
+	if domainsDatabase == "" {
+		domainsDatabase = "pfam"
+	}
+	if domainsDatabase != "pfam" && domainsDatabase != "interpro" && domainsDatabase != "uniprot" {
+		return http.StatusBadRequest, fmt.Errorf("invalid source of protein domains (available: InterPro, Pfam, UniProt)")
+	}
+	if err := checkLimits(s, req.DPI, len(req.Variants)); err != nil {
+		return http.StatusBadRequest, err
+	}
+	format := strings.ToLower(req.Format)
+	if format == "" {
+		format = "svg"
+	}
+	if format != "svg" && format != "png" && format != "json" {
+		return http.StatusBadRequest, fmt.Errorf("invalid format %q (available: svg, png, json)", req.Format)
+	}
+
+	acc := strings.ToUpper(strings.TrimSpace(req.Accession))
+	if acc != "" && !data.IsUniProtAccession(acc) {
+		return http.StatusBadRequest, fmt.Errorf("invalid UniProt accession %q", req.Accession)
+	}
+	if acc == "" {
+		if req.Gene == "" {
+			return http.StatusBadRequest, fmt.Errorf("one of gene or accession is required")
+		}
+		var err error
+		if (req.QueryDB == "" || req.QueryDB == "GENENAME") && uniprotEntries != nil {
+			acc, err = uniprotEntries.GetProtID(req.Gene)
+		} else if req.QueryDB == "" || req.QueryDB == "GENENAME" {
+			acc, err = data.GetProtIDContext(r.Context(), req.Gene)
+		} else {
+			acc, err = data.GetProtMappingContext(r.Context(), req.QueryDB, req.Gene)
+		}
+		if err != nil {
+			return http.StatusBadGateway, err
+		}
+	}
+
+	d, err := data.GetGraphicData(r.Context(), acc, &data.FetchOptions{
+		Domains: domainsDatabase,
+		Tracks:  req.Tracks,
+		Entries: uniprotEntries,
+	})
+	if err != nil {
+		return http.StatusBadGateway, err
+	}
+
+	// draw into a buffer so that a drawing error can still be reported
+	buf := &bytes.Buffer{}
+	contentType := "image/svg+xml"
+	switch format {
+	case "png":
+		dpi := req.DPI
+		if dpi <= 0 {
+			dpi = 72
+		}
+		contentType = "image/png"
+		err = s.DrawPNG(buf, dpi, req.Variants, d)
+	case "json":
+		var layout *drawing.Layout
+		contentType = "application/json"
+		layout, err = s.Layout(req.Variants, d)
+		if err == nil {
+			err = json.NewEncoder(buf).Encode(layout)
+		}
+	default:
+		err = s.DrawSVG(buf, req.Variants, d)
+	}
+	if err == drawing.ErrTooLarge {
+		return http.StatusBadRequest, err
+	}
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+	w.Header().Set("Content-Type", contentType)
+	if _, err = buf.WriteTo(w); err != nil {
+		// the response has started, so the client can only be told by the
+		// connection closing
+		log.Printf("render: writing response: %s", err)
+	}
+	return http.StatusOK, nil
+}
+
+// handleMetrics reports the server counters in the Prometheus text format.
+func (m *serverMetrics) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	hits, misses := data.CacheStats()
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# TYPE lollipops_render_requests_total counter\nlollipops_render_requests_total %d\n", atomic.LoadInt64(&m.requests))
+	fmt.Fprintf(w, "# TYPE lollipops_render_errors_total counter\nlollipops_render_errors_total %d\n", atomic.LoadInt64(&m.errors))
+	fmt.Fprintf(w, "# TYPE lollipops_render_seconds_total counter\nlollipops_render_seconds_total %g\n", float64(atomic.LoadInt64(&m.renderMicros))/1e6)
+	fmt.Fprintf(w, "# TYPE lollipops_cache_hits_total counter\nlollipops_cache_hits_total %d\n", hits)
+	fmt.Fprintf(w, "# TYPE lollipops_cache_misses_total counter\nlollipops_cache_misses_total %d\n", misses)
+}
@@ -0,0 +1,111 @@
+//go:build !wasm
+// +build !wasm
+
+//
+//    Lollipops command-line diagram generator for genetic variations.
+//    Copyright (C) 2015 Jeremy Jay <jeremy@pbnjay.com>
+//
+//    This program is free software: you can redistribute it and/or modify
+//    it under the terms of the GNU General Public License as published by
+//    the Free Software Foundation, either version 3 of the License, or
+//    (at your option) any later version.
+//
+//    This program is distributed in the hope that it will be useful,
+//    but WITHOUT ANY WARRANTY; without even the implied warranty of
+//    MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+//    GNU General Public License for more details.
+//
+//    You should have received a copy of the GNU General Public License
+//    along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/joiningdata/lollipops/data"
+	"github.com/joiningdata/lollipops/drawing"
+)
+
+// testEntry is a UniProt flat file entry, so that the tests do not need
+// network access.
+const testEntry = `ID   TEST_HUMAN              Reviewed;         60 AA.
+AC   P99999;
+DE   RecName: Full=Test protein;
+GN   Name=TEST1;
+OX   NCBI_TaxID=9606;
+FT   DOMAIN          10..40
+FT                   /note="Test domain"
+SQ   SEQUENCE   60 AA;  6000 MW;  0000000000000000 CRC64;
+     MEEPQSDPSV FWDKESRSPH ESAPQYARKI WEMAAAVAPH QATIRSVINI IRLAQVEGLE
+//
+`
+
+func TestServeRender(t *testing.T) {
+	if err := drawing.LoadDefaultFont(); err != nil {
+		t.Fatal(err)
+	}
+	filename := filepath.Join(t.TempDir(), "test.dat")
+	if err := os.WriteFile(filename, []byte(testEntry), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	uniprotEntries, err = data.OpenUniProtFile(filename, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { uniprotEntries = nil }()
+
+	m := &serverMetrics{}
+	srv := httptest.NewServer(m.handleRender())
+	defer srv.Close()
+
+	for _, c := range []struct {
+		name   string
+		body   string
+		status int
+		ctype  string
+	}{
+		{"svg", `{"accession": "P99999", "domains": "uniprot", "variants": ["R20C"]}`, http.StatusOK, "image/svg+xml"},
+		{"gene", `{"gene": "TEST1", "domains": "uniprot", "format": "json"}`, http.StatusOK, "application/json"},
+		{"png", `{"accession": "p99999", "domains": "uniprot", "format": "png", "dpi": 100}`, http.StatusOK, "image/png"},
+		{"width", `{"accession": "P99999", "domains": "uniprot", "settings": {"GraphicWidth": 500}}`, http.StatusOK, "image/svg+xml"},
+		{"zero width", `{"accession": "P99999", "domains": "uniprot", "settings": {"GraphicWidth": 0}}`, http.StatusBadRequest, ""},
+		{"negative width", `{"accession": "P99999", "domains": "uniprot", "settings": {"GraphicWidth": -100}}`, http.StatusBadRequest, ""},
+		{"wide", `{"accession": "P99999", "domains": "uniprot", "settings": {"GraphicWidth": 20000}}`, http.StatusBadRequest, ""},
+		{"dpi", `{"accession": "P99999", "domains": "uniprot", "format": "png", "dpi": 5000}`, http.StatusBadRequest, ""},
+		{"accession", `{"accession": "not an accession"}`, http.StatusBadRequest, ""},
+		{"format", `{"accession": "P99999", "format": "gif"}`, http.StatusBadRequest, ""},
+		{"no protein", `{"variants": ["R20C"]}`, http.StatusBadRequest, ""},
+		{"unknown field", `{"accession": "P99999", "colour": "red"}`, http.StatusBadRequest, ""},
+	} {
+		resp, err := http.Post(srv.URL, "application/json", strings.NewReader(c.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != c.status {
+			t.Errorf("%s: got status %d, expected %d", c.name, resp.StatusCode, c.status)
+		}
+		if c.ctype != "" && resp.Header.Get("Content-Type") != c.ctype {
+			t.Errorf("%s: got Content-Type %s, expected %s", c.name, resp.Header.Get("Content-Type"), c.ctype)
+		}
+	}
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("GET: got status %d, expected %d", resp.StatusCode, http.StatusMethodNotAllowed)
+	}
+	if m.requests != 12 || m.errors != 8 {
+		t.Errorf("got %d requests and %d errors, expected 12 and 8", m.requests, m.errors)
+	}
+}